@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+// assertion checks one block field on every tick, e.g. "db.health!=red",
+// "svc.queue_depth<100" or "*.dropped==0". Fields are BlockResult JSON names
+// or Ticker metric keys; "*" matches every block.
+type assertion struct {
+	raw   string
+	block string
+	field string
+	op    string
+	str   string
+	num   float64
+}
+
+type assertionError struct {
+	failures []string
+}
+
+func (e *assertionError) Error() string {
+	const maxShown = 20
+	shown := e.failures
+	if len(shown) > maxShown {
+		shown = shown[:maxShown]
+	}
+	msg := fmt.Sprintf("%d assertion failure(s):\n  %s", len(e.failures), strings.Join(shown, "\n  "))
+	if len(e.failures) > maxShown {
+		msg += fmt.Sprintf("\n  ... and %d more", len(e.failures)-maxShown)
+	}
+	return msg
+}
+
+var assertOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+func parseAssertion(s string) (assertion, error) {
+	a := assertion{raw: s}
+	for _, op := range assertOps {
+		if i := strings.Index(s, op); i >= 0 {
+			a.op = op
+			lhs, rhs := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(op):])
+			dot := strings.LastIndex(lhs, ".")
+			if dot <= 0 || dot == len(lhs)-1 || rhs == "" {
+				return a, fmt.Errorf("bad assertion %q: want block.field<op>value", s)
+			}
+			a.block, a.field = lhs[:dot], lhs[dot+1:]
+			if a.field == "health" {
+				if op != "==" && op != "!=" {
+					return a, fmt.Errorf("bad assertion %q: health supports only == and !=", s)
+				}
+				a.str = rhs
+				return a, nil
+			}
+			n, err := strconv.ParseFloat(rhs, 64)
+			if err != nil {
+				return a, fmt.Errorf("bad assertion %q: %w", s, err)
+			}
+			a.num = n
+			return a, nil
+		}
+	}
+	return a, fmt.Errorf("bad assertion %q: no comparison operator", s)
+}
+
+// check returns a description of every block that violates the assertion.
+func (a assertion) check(tr engine.TickResult) []string {
+	var fails []string
+	matched := false
+	for _, br := range tr.Blocks {
+		if a.block != "*" && br.ID != a.block {
+			continue
+		}
+		matched = true
+		if a.field == "health" {
+			if (a.op == "==") != (br.Health == a.str) {
+				fails = append(fails, fmt.Sprintf("tick %d: %s (health=%s)", tr.Tick, a.raw, br.Health))
+			}
+			continue
+		}
+		v, ok := numericField(br, a.field)
+		if !ok {
+			// Metrics are per kind; a wildcard skips blocks without the key.
+			if a.block != "*" {
+				fails = append(fails, fmt.Sprintf("tick %d: %s (no field %q on %s)", tr.Tick, a.raw, a.field, br.ID))
+			}
+			continue
+		}
+		if !compare(v, a.op, a.num) {
+			fails = append(fails, fmt.Sprintf("tick %d: %s (%s.%s=%g)", tr.Tick, a.raw, br.ID, a.field, v))
+		}
+	}
+	if !matched && a.block != "*" {
+		fails = append(fails, fmt.Sprintf("tick %d: %s (no block %q)", tr.Tick, a.raw, a.block))
+	}
+	return fails
+}
+
+func numericField(br engine.BlockResult, field string) (float64, bool) {
+	switch field {
+	case "rps":
+		return br.RPS, true
+	case "cpu_util":
+		return br.CPUUtil, true
+	case "mem_util":
+		return br.MemUtil, true
+	case "disk_util":
+		return br.DiskUtil, true
+	case "net_util":
+		return br.NetUtil, true
+	case "bottleneck":
+		return br.Bottleneck, true
+	case "queue_depth":
+		return br.QueueDepth, true
+	case "dropped":
+		return br.Dropped, true
+	case "latency":
+		return br.Latency, true
+	case "path_latency":
+		return br.PathLatency, true
+	case "lost_writes":
+		return br.LostWrites, true
+	}
+	v, ok := br.Metrics[field]
+	return v, ok
+}
+
+func compare(v float64, op string, want float64) bool {
+	switch op {
+	case "<":
+		return v < want
+	case "<=":
+		return v <= want
+	case ">":
+		return v > want
+	case ">=":
+		return v >= want
+	case "==":
+		return v == want
+	case "!=":
+		return v != want
+	}
+	return false
+}
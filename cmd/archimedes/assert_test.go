@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+func TestParseAssertion(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  assertion
+		wantE bool
+	}{
+		{in: "db.health!=red", want: assertion{block: "db", field: "health", op: "!=", str: "red"}},
+		{in: "*.dropped==0", want: assertion{block: "*", field: "dropped", op: "=="}},
+		{in: "svc.queue_depth <= 100", want: assertion{block: "svc", field: "queue_depth", op: "<=", num: 100}},
+		{in: "kv-store.p99.latency>2.5", want: assertion{block: "kv-store.p99", field: "latency", op: ">", num: 2.5}},
+		{in: "db.health<red", wantE: true},
+		{in: "db.rps<fast", wantE: true},
+		{in: "rps<10", wantE: true},
+		{in: "db.<10", wantE: true},
+		{in: "db.rps<", wantE: true},
+		{in: "db.rps", wantE: true},
+	} {
+		got, err := parseAssertion(tc.in)
+		if tc.wantE {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tc.in, got)
+			}
+			continue
+		}
+		tc.want.raw = tc.in
+		if err != nil || got != tc.want {
+			t.Errorf("%q: want %+v, got %+v (%v)", tc.in, tc.want, got, err)
+		}
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	tr := engine.TickResult{Tick: 3, Blocks: []engine.BlockResult{
+		{ID: "svc", Health: "green", RPS: 100, Metrics: map[string]float64{"pool_util": 0.5}},
+		{ID: "db", Health: "red", RPS: 100, Dropped: 20},
+	}}
+	for _, tc := range []struct {
+		in    string
+		fails int
+	}{
+		{"svc.health==green", 0},
+		{"db.health!=red", 1},
+		{"*.health!=red", 1},
+		{"*.dropped==0", 1},
+		{"*.rps>=100", 0},
+		{"svc.pool_util<0.6", 0},
+		{"*.pool_util<0.4", 1}, // db has no pool_util and is skipped
+		{"db.pool_util<0.6", 1},
+		{"cache.rps>0", 1},
+	} {
+		a, err := parseAssertion(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fails := a.check(tr); len(fails) != tc.fails {
+			t.Errorf("%q: want %d failures, got %v", tc.in, tc.fails, fails)
+		}
+	}
+}
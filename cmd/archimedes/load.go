@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+// LoadPoint sets the source RPS and read ratio at a tick. Between points the
+// load ramps linearly; after the last point it holds.
+type LoadPoint struct {
+	Tick      int     `json:"tick"`
+	RPS       float64 `json:"rps"`
+	ReadRatio float64 `json:"read_ratio"`
+}
+
+type LoadProfile []LoadPoint
+
+func (lp LoadProfile) validate() error {
+	if len(lp) == 0 {
+		return fmt.Errorf("load profile is empty")
+	}
+	for i := 1; i < len(lp); i++ {
+		if lp[i].Tick <= lp[i-1].Tick {
+			return fmt.Errorf("load profile ticks must increase: %d after %d", lp[i].Tick, lp[i-1].Tick)
+		}
+	}
+	return nil
+}
+
+func (lp LoadProfile) At(tick int) (rps, readRatio float64) {
+	if tick <= lp[0].Tick {
+		return lp[0].RPS, lp[0].ReadRatio
+	}
+	for i := 1; i < len(lp); i++ {
+		if tick <= lp[i].Tick {
+			a, b := lp[i-1], lp[i]
+			f := float64(tick-a.Tick) / float64(b.Tick-a.Tick)
+			return a.RPS + (b.RPS-a.RPS)*f, a.ReadRatio + (b.ReadRatio-a.ReadRatio)*f
+		}
+	}
+	last := lp[len(lp)-1]
+	return last.RPS, last.ReadRatio
+}
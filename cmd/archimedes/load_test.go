@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestLoadProfileAt(t *testing.T) {
+	lp := LoadProfile{{Tick: 10, RPS: 100, ReadRatio: 0.8}, {Tick: 20, RPS: 300, ReadRatio: 0.4}}
+	if err := lp.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		tick    int
+		rps, rr float64
+	}{
+		{0, 100, 0.8}, // before the first point it holds
+		{10, 100, 0.8},
+		{15, 200, 0.6}, // halfway up the ramp
+		{20, 300, 0.4},
+		{99, 300, 0.4}, // and after the last
+	} {
+		rps, rr := lp.At(tc.tick)
+		if rps != tc.rps || rr < tc.rr-1e-9 || rr > tc.rr+1e-9 {
+			t.Errorf("tick %d: want %g rps at %g, got %g at %g", tc.tick, tc.rps, tc.rr, rps, rr)
+		}
+	}
+}
+
+func TestLoadProfileRejected(t *testing.T) {
+	for name, lp := range map[string]LoadProfile{
+		"empty":     nil,
+		"repeated":  {{Tick: 5}, {Tick: 5}},
+		"backwards": {{Tick: 10}, {Tick: 5}},
+	} {
+		if err := lp.validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
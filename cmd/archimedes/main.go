@@ -0,0 +1,220 @@
+// Command archimedes runs a topology headlessly and writes per-tick block
+// results for scripts and notebooks.
+//
+//	archimedes -topo netflix.json -ticks 600 -load ramp.json -format csv \
+//	    -assert 'db.health!=red' -assert '*.dropped==0'
+//
+// With -ticks 0 the steady-state model (engine.Simulate) runs once.
+// With -replay, a run file recorded by the server is replayed and checked
+// for bit-for-bit identical results instead.
+// The exit status is 1 when any assertion or replay check fails and 2 on
+// bad input.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	_ "github.com/prashanth/archimedes/internal/blocks/cache"
+	customblocks "github.com/prashanth/archimedes/internal/blocks/custom"
+	_ "github.com/prashanth/archimedes/internal/blocks/datastore"
+	_ "github.com/prashanth/archimedes/internal/blocks/docstore"
+	_ "github.com/prashanth/archimedes/internal/blocks/kv"
+	_ "github.com/prashanth/archimedes/internal/blocks/queue"
+	_ "github.com/prashanth/archimedes/internal/blocks/search"
+	_ "github.com/prashanth/archimedes/internal/blocks/storage"
+	"github.com/prashanth/archimedes/internal/engine"
+	"github.com/prashanth/archimedes/internal/presets"
+)
+
+type assertFlags []string
+
+func (a *assertFlags) String() string     { return strings.Join(*a, ", ") }
+func (a *assertFlags) Set(s string) error { *a = append(*a, s); return nil }
+
+func main() {
+	var asserts assertFlags
+	topoPath := flag.String("topo", "", "topology JSON file, or preset:<id> for a built-in preset (required)")
+	ticks := flag.Int("ticks", 0, "number of ticks to simulate; 0 runs the steady-state model once")
+	dt := flag.Float64("dt", 0.1, "simulated seconds per tick")
+	loadPath := flag.String("load", "", "load profile JSON file: [{\"tick\":0,\"rps\":1000,\"read_ratio\":0.8}, ...]")
+	format := flag.String("format", "jsonl", "output format: csv or jsonl")
+	outPath := flag.String("out", "", "output file (default stdout)")
+	flag.Var(&asserts, "assert", "health assertion, e.g. 'db.health!=red' or '*.dropped==0' (repeatable)")
+	replayPath := flag.String("replay", "", "replay a recorded run file and verify its results")
+	blocksDir := flag.String("blocks-dir", "blocks", "directory of JSON custom block type definitions")
+	flag.Parse()
+
+	if _, err := customblocks.LoadDir(*blocksDir); err != nil {
+		fmt.Fprintln(os.Stderr, "archimedes:", err)
+		os.Exit(2)
+	}
+
+	if *replayPath != "" {
+		if err := replay(*replayPath); err != nil {
+			fmt.Fprintln(os.Stderr, "archimedes:", err)
+			if _, ok := err.(*replayError); ok {
+				os.Exit(1)
+			}
+			os.Exit(2)
+		}
+		return
+	}
+
+	if err := run(*topoPath, *ticks, *dt, *loadPath, *format, *outPath, asserts); err != nil {
+		fmt.Fprintln(os.Stderr, "archimedes:", err)
+		if _, ok := err.(*assertionError); ok {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(topoPath string, ticks int, dt float64, loadPath, format, outPath string, rawAsserts []string) error {
+	if topoPath == "" {
+		return fmt.Errorf("-topo is required")
+	}
+	if err := engine.CheckTickResolution(dt); err != nil {
+		return fmt.Errorf("-dt: %w", err)
+	}
+	var topo engine.Topology
+	if id, ok := strings.CutPrefix(topoPath, "preset:"); ok {
+		p, ok := presets.Get(id)
+		if !ok {
+			return fmt.Errorf("unknown preset %q", id)
+		}
+		topo = p.Topology
+	} else if err := readJSON(topoPath, &topo); err != nil {
+		return err
+	}
+	report := engine.Validate(topo)
+	for _, is := range report.Warnings {
+		fmt.Fprintln(os.Stderr, "archimedes: warning:", is.Message)
+	}
+	if !report.OK() {
+		return &engine.ValidationError{Report: report}
+	}
+	g, err := engine.BuildGraph(topo)
+	if err != nil {
+		return err
+	}
+
+	load := LoadProfile{{RPS: topo.RPS, ReadRatio: topo.ReadRatio}}
+	if loadPath != "" {
+		load = nil
+		if err := readJSON(loadPath, &load); err != nil {
+			return err
+		}
+		if err := load.validate(); err != nil {
+			return fmt.Errorf("%s: %w", loadPath, err)
+		}
+	}
+
+	asserts := make([]assertion, len(rawAsserts))
+	for i, s := range rawAsserts {
+		if asserts[i], err = parseAssertion(s); err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	var outFile *os.File
+	if outPath != "" {
+		if outFile, err = os.Create(outPath); err != nil {
+			return err
+		}
+		defer outFile.Close() // early returns only; success closes below
+		out = outFile
+	}
+	w, err := newResultWriter(out, format)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	emit := func(tr engine.TickResult) error {
+		for _, a := range asserts {
+			failures = append(failures, a.check(tr)...)
+		}
+		return w.Write(tr)
+	}
+
+	if ticks <= 0 {
+		rps, rr := load.At(0)
+		results, err := engine.Simulate(g, rps, rr)
+		if err != nil {
+			return err
+		}
+		if err := emit(engine.TickResult{Blocks: results}); err != nil {
+			return err
+		}
+	} else {
+		state := engine.NewSimState(g)
+		state.Dt = dt
+		for t := 1; t <= ticks; t++ {
+			rps, rr := load.At(t)
+			results, err := engine.SimulateTick(g, rps, rr, state)
+			if err != nil {
+				return err
+			}
+			if err := emit(engine.TickResult{Tick: t, SimTime: state.SimTime, Blocks: results}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// A failed close can lose buffered output, so it fails the run.
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &assertionError{failures}
+	}
+	return nil
+}
+
+func readJSON(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+type replayError struct {
+	report *engine.ReplayReport
+}
+
+func (e *replayError) Error() string {
+	return fmt.Sprintf("replay diverged on %d of %d ticks, first at tick %d",
+		len(e.report.Mismatches), e.report.Ticks, e.report.Mismatches[0])
+}
+
+func replay(path string) error {
+	var rec engine.Recording
+	if err := readJSON(path, &rec); err != nil {
+		return err
+	}
+	report, err := engine.Replay(&rec)
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return &replayError{report}
+	}
+	fmt.Printf("replay identical over %d ticks\n", report.Ticks)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain runs the command itself when re-executed by runCLI, so tests see
+// its real flag parsing and exit status.
+func TestMain(m *testing.M) {
+	if os.Getenv("ARCHIMEDES_TEST_MAIN") == "1" {
+		os.Args = append(os.Args[:1], flagArgs(os.Args[1:])...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// flagArgs drops everything up to the "--" runCLI puts before its args.
+func flagArgs(args []string) []string {
+	for i, a := range args {
+		if a == "--" {
+			return args[i+1:]
+		}
+	}
+	return args
+}
+
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "ARCHIMEDES_TEST_MAIN=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), stderr.String()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0, stderr.String()
+}
+
+// writeTopo writes a small user -> cdn -> service topology to a temp file.
+func writeTopo(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "topo.json")
+	topo := `{
+		"blocks": [{"id": "u", "kind": "user"}, {"id": "cdn", "kind": "cdn"}, {"id": "svc", "kind": "service"}],
+		"edges": [{"from": "u", "to": "cdn"}, {"from": "cdn", "to": "svc"}],
+		"rps": 1000,
+		"read_ratio": 0.8
+	}`
+	if err := os.WriteFile(path, []byte(topo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExitStatus(t *testing.T) {
+	topo := writeTopo(t)
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	for _, tc := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"passing", []string{"-topo", topo, "-ticks", "20", "-out", out, "-assert", "*.rps>=0"}, 0},
+		{"steady state", []string{"-topo", topo, "-out", out, "-format", "csv"}, 0},
+		{"failing", []string{"-topo", topo, "-ticks", "20", "-out", out, "-assert", "cdn.rps<0"}, 1},
+		{"preset", []string{"-topo", "preset:netflix", "-ticks", "20", "-out", out, "-assert", "*.rps>=0"}, 0},
+		{"unknown preset", []string{"-topo", "preset:nope", "-out", out}, 2},
+		{"missing topology", []string{"-topo", filepath.Join(t.TempDir(), "nope.json"), "-out", out}, 2},
+		{"no topology", []string{"-ticks", "5"}, 2},
+		{"bad assertion", []string{"-topo", topo, "-out", out, "-assert", "cdn.rps"}, 2},
+		{"bad format", []string{"-topo", topo, "-out", out, "-format", "xml"}, 2},
+		{"bad flag", []string{"-ticks", "many"}, 2},
+		{"NaN tick", []string{"-topo", topo, "-ticks", "5", "-dt", "NaN", "-out", out}, 2},
+		{"long tick", []string{"-topo", topo, "-ticks", "5", "-dt", "3600", "-out", out}, 2},
+		{"unwritable output", []string{"-topo", topo, "-ticks", "5", "-out", "/dev/full"}, 2},
+	} {
+		if got, stderr := runCLI(t, tc.args...); got != tc.want {
+			t.Errorf("%s: want exit %d, got %d: %s", tc.name, tc.want, got, stderr)
+		}
+	}
+}
+
+func TestWritesEveryTick(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	if code, stderr := runCLI(t, "-topo", writeTopo(t), "-ticks", "15", "-out", out); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 15 {
+		t.Errorf("want one line per tick, got %d", lines)
+	}
+}
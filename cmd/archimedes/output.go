@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+type resultWriter interface {
+	Write(tr engine.TickResult) error
+	Flush() error
+}
+
+func newResultWriter(w io.Writer, format string) (resultWriter, error) {
+	switch format {
+	case "jsonl":
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (want csv or jsonl)", format)
+}
+
+// jsonlWriter writes one TickResult per line.
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(tr engine.TickResult) error { return j.enc.Encode(tr) }
+func (j *jsonlWriter) Flush() error                     { return nil }
+
+// csvWriter writes one row per block per tick. Ticker metrics are packed
+// into a single "key=value;..." column since each kind reports its own set.
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+var csvHeader = []string{
+	"tick", "sim_time", "id", "kind", "name", "rps", "cpu_util", "mem_util", "disk_util", "net_util",
+	"bottleneck", "health", "queue_depth", "dropped", "latency", "path_latency",
+	"saturated", "lost_writes", "metrics",
+}
+
+func (c *csvWriter) Write(tr engine.TickResult) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	for _, br := range tr.Blocks {
+		row := []string{
+			strconv.Itoa(tr.Tick), ftoa(tr.SimTime), br.ID, br.Kind, br.Name,
+			ftoa(br.RPS), ftoa(br.CPUUtil), ftoa(br.MemUtil), ftoa(br.DiskUtil), ftoa(br.NetUtil),
+			ftoa(br.Bottleneck), br.Health, ftoa(br.QueueDepth), ftoa(br.Dropped),
+			ftoa(br.Latency), ftoa(br.PathLatency), strconv.FormatBool(br.Saturated),
+			ftoa(br.LostWrites), packMetrics(br.Metrics),
+		}
+		if err := c.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func ftoa(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+func packMetrics(m map[string]float64) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + ftoa(m[k])
+	}
+	return strings.Join(parts, ";")
+}
@@ -2,23 +2,71 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/prashanth/archimedes/internal/blocks"
 	_ "github.com/prashanth/archimedes/internal/blocks/cache"
+	customblocks "github.com/prashanth/archimedes/internal/blocks/custom"
 	_ "github.com/prashanth/archimedes/internal/blocks/datastore"
+	_ "github.com/prashanth/archimedes/internal/blocks/docstore"
+	_ "github.com/prashanth/archimedes/internal/blocks/kv"
 	_ "github.com/prashanth/archimedes/internal/blocks/queue"
 	_ "github.com/prashanth/archimedes/internal/blocks/search"
+	_ "github.com/prashanth/archimedes/internal/blocks/storage"
 	"github.com/prashanth/archimedes/internal/engine"
+	"github.com/prashanth/archimedes/internal/instances"
+	"github.com/prashanth/archimedes/internal/presets"
+	"github.com/prashanth/archimedes/internal/session"
+	"github.com/prashanth/archimedes/internal/store"
 )
 
+const defaultSession = "default"
+
 func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	maxSessions := flag.Int("max-sessions", 32, "maximum concurrent simulation sessions")
+	storeDir := flag.String("store-dir", "data/topologies", "directory for saved topologies")
+	blocksDir := flag.String("blocks-dir", "blocks", "directory of JSON custom block type definitions")
+	idle := flag.Duration("session-idle", 30*time.Minute, "stop sessions unused for this long")
+	flag.Parse()
+
+	custom, err := customblocks.LoadDir(*blocksDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, b := range custom {
+		log.Printf("loaded custom block %s (%s)", b.Kind(), b.Name())
+	}
+
 	mux := http.NewServeMux()
 	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	sim := engine.NewSim()
+	sessions := session.NewManager(*maxSessions, *idle)
+	topos, err := store.Open(*storeDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// simRoute registers h for the default session at /api/<path> and for a
+	// named session at /api/s/{session}/<path>.
+	simRoute := func(method, path string, h func(http.ResponseWriter, *http.Request, *engine.Sim)) {
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			sim, err := sessions.Get(sessionID(r))
+			if err != nil {
+				http.Error(w, err.Error(), sessionStatus(err))
+				return
+			}
+			h(w, r, sim)
+		}
+		mux.HandleFunc(method+" /api"+path, handler)
+		mux.HandleFunc(method+" /api/s/{session}"+path, handler)
+	}
 
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
 		tmpl.Execute(w, nil)
@@ -27,22 +75,33 @@ func main() {
 	mux.HandleFunc("GET /api/blocks", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		type entry struct {
-			Kind string `json:"kind"`
-			Name string `json:"name"`
+			Kind        string `json:"kind"`
+			Name        string `json:"name"`
+			Category    string `json:"category,omitempty"`
+			Icon        string `json:"icon,omitempty"`
+			Description string `json:"description,omitempty"`
 		}
 		out := make([]entry, len(blocks.Types))
 		for i, b := range blocks.Types {
-			out[i] = entry{b.Kind(), b.Name()}
+			out[i] = entry{Kind: b.Kind(), Name: b.Name()}
+			if d, ok := b.(blocks.Describer); ok {
+				m := d.Describe()
+				out[i].Category, out[i].Icon, out[i].Description = m.Category, m.Icon, m.Description
+			}
 		}
 		json.NewEncoder(w).Encode(out)
 	})
 
 	mux.HandleFunc("GET /api/blocks/html", func(w http.ResponseWriter, r *http.Request) {
 		for _, b := range blocks.Types {
+			icon := b.Kind()
+			if d, ok := b.(blocks.Describer); ok && d.Describe().Icon != "" {
+				icon = d.Describe().Icon
+			}
 			fmt.Fprintf(w, `<div draggable="true" data-kind="%s" data-name="%s" class="flex items-center gap-2 px-3 py-2 bg-gray-800 rounded text-sm cursor-grab hover:bg-gray-700 transition-colors select-none">
 				<img src="/static/icons/%s.svg" class="w-4 h-4 invert opacity-70" alt="" draggable="false">
 				<span>%s</span>
-			</div>`, b.Kind(), b.Name(), b.Kind(), b.Name())
+			</div>`, b.Kind(), b.Name(), icon, b.Name())
 		}
 	})
 
@@ -66,20 +125,174 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]any{"blocks": results})
 	})
 
-	mux.HandleFunc("POST /api/play", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("POST /api/topology/validate", func(w http.ResponseWriter, r *http.Request) {
+		var topo engine.Topology
+		if err := json.NewDecoder(r.Body).Decode(&topo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engine.Validate(topo))
+	})
+
+	mux.HandleFunc("POST /api/topology/cost", func(w http.ResponseWriter, r *http.Request) {
+		var topo engine.Topology
+		if err := json.NewDecoder(r.Body).Decode(&topo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		g, err := engine.BuildGraph(topo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engine.Cost(g))
+	})
+
+	mux.HandleFunc("GET /api/instances", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(instances.List())
+	})
+
+	mux.HandleFunc("GET /api/presets", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presets.List())
+	})
+
+	mux.HandleFunc("GET /api/presets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := presets.Get(r.PathValue("id"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	})
+
+	mux.HandleFunc("GET /api/topologies", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := topos.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+
+	mux.HandleFunc("GET /api/topologies/{name}", func(w http.ResponseWriter, r *http.Request) {
+		version := 0
+		if q := r.URL.Query().Get("version"); q != "" {
+			n, err := strconv.Atoi(q)
+			if err != nil || n < 1 {
+				http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			version = n
+		}
+		v, err := topos.Load(r.PathValue("name"), version)
+		if err != nil {
+			http.Error(w, err.Error(), storeStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	})
+
+	mux.HandleFunc("GET /api/topologies/{name}/versions", func(w http.ResponseWriter, r *http.Request) {
+		history, err := topos.History(r.PathValue("name"))
+		if err != nil {
+			http.Error(w, err.Error(), storeStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	})
+
+	mux.HandleFunc("PUT /api/topologies/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var topo engine.Topology
+		if err := json.NewDecoder(r.Body).Decode(&topo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := engine.BuildGraph(topo); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		v, err := topos.Save(r.PathValue("name"), topo)
+		if err != nil {
+			http.Error(w, err.Error(), storeStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			Version int `json:"version"`
+		}{v.Version})
+	})
+
+	mux.HandleFunc("POST /api/topologies/{name}/rename", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := topos.Rename(r.PathValue("name"), body.Name); err != nil {
+			http.Error(w, err.Error(), storeStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /api/topologies/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := topos.Delete(r.PathValue("name")); err != nil {
+			http.Error(w, err.Error(), storeStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/montecarlo", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Topology engine.Topology         `json:"topology"`
+			Config   engine.MonteCarloConfig `json:"config"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res, err := engine.MonteCarlo(body.Topology, body.Config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+
+	simRoute("POST", "/play", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
 		var topo engine.Topology
 		if err := json.NewDecoder(r.Body).Decode(&topo); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		if err := sim.Play(topo); err != nil {
+			var verr *engine.ValidationError
+			if errors.As(err, &verr) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(verr.Report)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	mux.HandleFunc("POST /api/topology/update", func(w http.ResponseWriter, r *http.Request) {
+	simRoute("POST", "/topology/update", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
 		var topo engine.Topology
 		if err := json.NewDecoder(r.Body).Decode(&topo); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -92,12 +305,110 @@ func main() {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	mux.HandleFunc("POST /api/pause", func(w http.ResponseWriter, r *http.Request) {
+	simRoute("POST", "/pause", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
 		sim.Pause()
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	mux.HandleFunc("POST /api/rps", func(w http.ResponseWriter, r *http.Request) {
+	simRoute("POST", "/freeze", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		if err := sim.Freeze(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	simRoute("POST", "/resume", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		if err := sim.Resume(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	simRoute("POST", "/step", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		body := struct {
+			Ticks int `json:"ticks"`
+		}{Ticks: 1}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		tr, err := sim.Step(body.Ticks)
+		if errors.Is(err, engine.ErrNotRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tr)
+	})
+
+	simRoute("POST", "/stop", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		sim.Stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	simRoute("GET", "/snapshot", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		snap, err := sim.Snapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snap)
+	})
+
+	simRoute("POST", "/restore", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		var snap engine.Snapshot
+		if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sim.Restore(&snap); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	simRoute("POST", "/record/start", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		sim.StartRecording()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	simRoute("POST", "/record/stop", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		rec, err := sim.StopRecording()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="run.json"`)
+		json.NewEncoder(w).Encode(rec)
+	})
+
+	mux.HandleFunc("POST /api/replay", func(w http.ResponseWriter, r *http.Request) {
+		var rec engine.Recording
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := engine.Replay(&rec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	simRoute("POST", "/rps", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
 		var body struct {
 			RPS       float64 `json:"rps"`
 			ReadRatio float64 `json:"read_ratio"`
@@ -110,12 +421,54 @@ func main() {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+	simRoute("POST", "/speed", func(w http.ResponseWriter, r *http.Request, sim *engine.Sim) {
+		var body struct {
+			Speed  *float64 `json:"speed"`   // simulated seconds per wall-clock second
+			Max    bool     `json:"max"`     // run as fast as possible, ignoring speed
+			TickMs *float64 `json:"tick_ms"` // simulated milliseconds per tick
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.Max {
+			speed := engine.MaxSpeed()
+			body.Speed = &speed
+		}
+		// Check both before applying either, so a bad request changes nothing.
+		var errs []error
+		if body.Speed != nil {
+			errs = append(errs, engine.CheckSpeed(*body.Speed))
+		}
+		if body.TickMs != nil {
+			errs = append(errs, engine.CheckTickResolution(*body.TickMs/1000))
+		}
+		if err := errors.Join(errs...); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if body.Speed != nil {
+			sim.SetSpeed(*body.Speed)
+		}
+		if body.TickMs != nil {
+			sim.SetTickResolution(*body.TickMs / 1000)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	events := func(w http.ResponseWriter, r *http.Request) {
 		flusher, ok := w.(http.Flusher)
 		if !ok {
 			http.Error(w, "streaming not supported", http.StatusInternalServerError)
 			return
 		}
+		sim, release, err := sessions.Hold(sessionID(r))
+		if err != nil {
+			http.Error(w, err.Error(), sessionStatus(err))
+			return
+		}
+		defer release()
+
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
@@ -133,10 +486,38 @@ func main() {
 				flusher.Flush()
 			}
 		}
-	})
+	}
+	mux.HandleFunc("GET /api/events", events)
+	mux.HandleFunc("GET /api/s/{session}/events", events)
 
 	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
-	log.Println("listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	log.Println("listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func sessionID(r *http.Request) string {
+	if id := r.PathValue("session"); id != "" {
+		return id
+	}
+	return defaultSession
+}
+
+func storeStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrBadName):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func sessionStatus(err error) int {
+	if errors.Is(err, session.ErrTooMany) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
 }
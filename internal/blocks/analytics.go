@@ -36,14 +36,15 @@ func (Analytics) Tick(ctx TickContext) TickEffect {
 	total := ctx.Reads + ctx.Writes
 	readRPS := ctx.Reads / ctx.Dt
 	writeRPS := ctx.Writes / ctx.Dt
-	active := math.Min(readRPS*analyticsReadHoldSec+writeRPS*analyticsWriteHoldSec, queryThreads)
+	threads := float64(ctx.Profile.MaxConcurrency)
+	active := math.Min(readRPS*analyticsReadHoldSec+writeRPS*analyticsWriteHoldSec, threads)
 	ctx.State["active_queries"] = active
 
 	readRatio := ctx.Reads / math.Max(total, 1)
-	memPerReq := analyticsReadMemMB*readRatio + analyticsWriteMemMB*(1-readRatio)
-	memPressure := active * memPerReq / analyticsMemMB
+	memPerReq := ctx.Profile.Read.MemoryMB*readRatio + ctx.Profile.Write.MemoryMB*(1-readRatio)
+	memPressure := active * memPerReq / float64(ctx.Profile.MemoryMB)
 
-	poolUtil := active / queryThreads
+	poolUtil := active / threads
 	e := TickEffect{
 		CapMultiplier: 1.0,
 		Metrics: map[string]float64{
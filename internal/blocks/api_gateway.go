@@ -31,7 +31,8 @@ func (APIGateway) InitState(state map[string]float64) {
 // the gateway starts rejecting requests and adds auth/routing latency.
 func (APIGateway) Tick(ctx TickContext) TickEffect {
 	totalRPS := (ctx.Reads + ctx.Writes) / ctx.Dt
-	rateUtil := math.Min(totalRPS/gwRateLimit, 1.0)
+	// Each replica enforces its own limit.
+	rateUtil := math.Min(totalRPS/(gwRateLimit*float64(max(ctx.Replicas, 1))), 1.0)
 	ctx.State["rate_util"] = rateUtil
 
 	capMult := 1.0
@@ -1,35 +1,61 @@
 package blocks
 
+import "math"
+
 type Durability string
 
+// Durability is a block's fsync policy. None keeps acknowledged writes in
+// memory only, batch acknowledges before a periodic flush (group commit), and
+// per-write fsyncs every write before acknowledging it.
 const (
 	DurabilityNone     Durability = "none"
 	DurabilityBatch    Durability = "batch"
 	DurabilityPerWrite Durability = "per-write"
 )
 
+// DefaultFlushIntervalMs is how often a batch-durable block flushes when its
+// profile does not say.
+const DefaultFlushIntervalMs = 1000
+
 const (
 	SSDDiskIOPS = 50000 // modern NVMe
 	HDDDiskIOPS = 200
 )
 
+// BaseDt is the tick length, in seconds, that per-tick rates in block
+// behaviors (decay, warm-up, buildup) are tuned for.
+const BaseDt = 0.1
+
+// Rate converts a fraction applied once per BaseDt tick into the equivalent
+// fraction for a tick of dt seconds, so dynamics follow simulated time rather
+// than tick count.
+func Rate(perTick, dt float64) float64 {
+	if dt == BaseDt || dt <= 0 {
+		return perTick
+	}
+	return 1 - math.Pow(1-perTick, dt/BaseDt)
+}
+
 type OpCost struct {
 	CPUMs      float64
 	MemoryMB   float64
 	DiskIOs    float64
 	Sequential bool
+	NetworkKB  float64 // bytes on the wire per op; only limits blocks with NetworkMBps set
 }
 
 type Profile struct {
 	CPUCores         int
 	MemoryMB         int
 	DiskIOPS         int
+	NetworkMBps      float64 // 0 = not network bound
 	Read             OpCost
 	Write            OpCost
 	MaxConcurrency   int
 	BufferPoolRatio  float64
 	Durability       Durability
-	DefaultReadRatio float64 // 0 = use global, otherwise block's natural ratio
+	FlushIntervalMs  float64 // batch durability: ms between flushes; 0 = DefaultFlushIntervalMs
+	DefaultReadRatio float64 // natural mix, assumed while idle; traffic brings its own. 0 = global
 }
 
 type Block interface {
@@ -38,6 +64,19 @@ type Block interface {
 	Profile() Profile
 }
 
+// Meta is display information for a block type.
+type Meta struct {
+	Category    string // sidebar group: traffic, compute, storage, queue
+	Icon        string // kind whose icon to show
+	Description string
+}
+
+// Describer is an optional interface for blocks that carry their own display
+// information. Built-in blocks are laid out by the UI instead.
+type Describer interface {
+	Describe() Meta
+}
+
 // Ticker is an optional interface blocks can implement for custom per-tick
 // simulation behavior (e.g. memory eviction, connection pool exhaustion).
 type Ticker interface {
@@ -52,11 +91,36 @@ type TickContext struct {
 	Dt     float64            // tick duration in seconds
 	State  map[string]float64 // mutable per-block state (persists across ticks)
 	Tick   int                // current tick number
+
+	// Profile is the node's profile with per-node overrides applied, scaled
+	// to all its replicas and shards like the static capacity model. Tickers
+	// read pool sizes and memory from it rather than their own constants.
+	Profile Profile
+
+	Replicas int                // replicas of the node; 0 is treated as 1
+	Shards   int                // shards of the node; 0 is treated as 1
+	Params   map[string]float64 // the node's per-node overrides; read-only
+}
+
+// Instances is the number of replica-shard instances the node runs, for
+// per-instance limits the profile does not carry.
+func (c TickContext) Instances() float64 {
+	return float64(max(c.Replicas, 1) * max(c.Shards, 1))
 }
 
+// Per-node parameters block behaviors read from TickContext.Params. The
+// engine validates them along with its other overrides.
+const (
+	ParamHotRowFraction = "hot_row_fraction" // share of writes to a few hot rows
+	ParamHotRows        = "hot_rows"         // how many rows those writes share
+	ParamDeadlocks      = "deadlocks"        // 1 aborts deadlock victims
+)
+
 type TickEffect struct {
 	CapMultiplier float64
+	Limit         float64 // most requests processed this tick, if above 0; unlike CapMultiplier, free of contention
 	AbsorbRatio   float64 // fraction of processed traffic not forwarded downstream
+	AbortRatio    float64 // fraction of processed writes that fail, e.g. deadlock victims
 	Latency       float64
 	Saturated     bool
 	Metrics       map[string]float64
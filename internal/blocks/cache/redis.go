@@ -24,8 +24,8 @@ func (Redis) Profile() blocks.Profile {
 	return blocks.Profile{
 		CPUCores: 1,
 		MemoryMB: totalMemMB,
-		Read:     blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: memPerWrite},
-		Write:    blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: memPerWrite},
+		Read:     blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: memPerWrite, NetworkKB: 1},
+		Write:    blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: memPerWrite, NetworkKB: 1},
 		MaxConcurrency: singleThread,
 		Durability:       blocks.DurabilityNone,
 		DefaultReadRatio: 0.95,
@@ -40,15 +40,16 @@ func (Redis) InitState(state map[string]float64) {
 // LRU eviction runs on the single thread, stealing CPU from request processing.
 func (Redis) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	used := ctx.State["memory_used_mb"]
+	memMB := float64(ctx.Profile.MemoryMB)
 
 	// Writes add memory, TTLs naturally reclaim some.
-	used += ctx.Writes * memPerWrite
-	used -= used * ttlDecayRate
+	used += ctx.Writes * ctx.Profile.Write.MemoryMB
+	used -= used * blocks.Rate(ttlDecayRate, ctx.Dt)
 	used = math.Max(used, 0)
-	used = math.Min(used, totalMemMB)
+	used = math.Min(used, memMB)
 	ctx.State["memory_used_mb"] = used
 
-	memPct := used / totalMemMB
+	memPct := used / memMB
 	evicting := 0.0
 	e := blocks.TickEffect{
 		CapMultiplier: 1.0,
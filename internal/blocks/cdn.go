@@ -37,9 +37,9 @@ func (CDN) Tick(ctx TickContext) TickEffect {
 
 	total := ctx.Reads + ctx.Writes
 	if total > 0 {
-		ratio += cdnWarmupRate * (1 - ratio)
+		ratio += Rate(cdnWarmupRate, ctx.Dt) * (1 - ratio)
 	} else {
-		ratio -= cdnDecayRate * ratio
+		ratio -= Rate(cdnDecayRate, ctx.Dt) * ratio
 	}
 	ratio = math.Max(0, math.Min(1, ratio))
 	ctx.State["hit_ratio"] = ratio
@@ -0,0 +1,208 @@
+// Package custom loads block types declared in JSON files, so new components
+// can be modelled without writing Go. A definition gives a Profile, sidebar
+// metadata, and a list of behaviors built from the standard state models in
+// models.go.
+package custom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+var validKind = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+type OpCostDef struct {
+	CPUMs      float64 `json:"cpu_ms"`
+	MemoryMB   float64 `json:"memory_mb,omitempty"`
+	DiskIOs    float64 `json:"disk_ios,omitempty"`
+	Sequential bool    `json:"sequential,omitempty"`
+	NetworkKB  float64 `json:"network_kb,omitempty"`
+}
+
+type ProfileDef struct {
+	CPUCores         int       `json:"cpu_cores"`
+	MemoryMB         int       `json:"memory_mb"`
+	DiskIOPS         int       `json:"disk_iops,omitempty"`
+	NetworkMBps      float64   `json:"network_mbps,omitempty"`
+	Read             OpCostDef `json:"read"`
+	Write            OpCostDef `json:"write"`
+	MaxConcurrency   int       `json:"max_concurrency,omitempty"`
+	BufferPoolRatio  float64   `json:"buffer_pool_ratio,omitempty"`
+	Durability       string    `json:"durability,omitempty"`
+	FlushIntervalMs  float64   `json:"flush_interval_ms,omitempty"`
+	DefaultReadRatio float64   `json:"default_read_ratio,omitempty"`
+}
+
+type BehaviorDef struct {
+	Model  string             `json:"model"`
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// Def is the on-disk form of a block type.
+type Def struct {
+	Kind        string        `json:"kind"`
+	Name        string        `json:"name"`
+	Category    string        `json:"category,omitempty"` // sidebar group: traffic, compute, storage, queue
+	Icon        string        `json:"icon,omitempty"`     // kind whose icon to reuse
+	Description string        `json:"description,omitempty"`
+	Profile     ProfileDef    `json:"profile"`
+	Behaviors   []BehaviorDef `json:"behaviors,omitempty"`
+}
+
+// Block is a block type built from a Def. It implements blocks.Block,
+// blocks.Ticker and blocks.Describer.
+type Block struct {
+	def     Def
+	profile blocks.Profile
+	models  []model
+}
+
+func (b *Block) Kind() string            { return b.def.Kind }
+func (b *Block) Name() string            { return b.def.Name }
+func (b *Block) Profile() blocks.Profile { return b.profile }
+
+func (b *Block) Describe() blocks.Meta {
+	return blocks.Meta{Category: b.def.Category, Icon: b.def.Icon, Description: b.def.Description}
+}
+
+func (b *Block) InitState(state map[string]float64) {
+	for _, m := range b.models {
+		m.init(state)
+	}
+}
+
+// Tick runs each behavior and combines their effects: capacity multipliers
+// multiply, latencies add, the smallest limit and the largest absorb ratio
+// win, and the block is saturated if any behavior is.
+func (b *Block) Tick(ctx blocks.TickContext) blocks.TickEffect {
+	e := blocks.TickEffect{CapMultiplier: 1, Metrics: map[string]float64{}}
+	for _, m := range b.models {
+		me := m.tick(ctx)
+		if me.CapMultiplier > 0 {
+			e.CapMultiplier *= me.CapMultiplier
+		}
+		if me.Limit > 0 && (e.Limit == 0 || me.Limit < e.Limit) {
+			e.Limit = me.Limit
+		}
+		e.Latency += me.Latency
+		e.AbsorbRatio = max(e.AbsorbRatio, me.AbsorbRatio)
+		e.Saturated = e.Saturated || me.Saturated
+		for k, v := range me.Metrics {
+			e.Metrics[k] = v
+		}
+	}
+	return e
+}
+
+// Parse builds a block type from one JSON definition.
+func Parse(data []byte) (*Block, error) {
+	// A misspelt field would otherwise leave its setting silently unset.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var def Def
+	if err := dec.Decode(&def); err != nil {
+		return nil, err
+	}
+	return New(def)
+}
+
+// New validates def and builds its block type.
+func New(def Def) (*Block, error) {
+	if !validKind.MatchString(def.Kind) {
+		return nil, fmt.Errorf("invalid kind %q: want lowercase letters, digits and underscores", def.Kind)
+	}
+	if def.Name == "" {
+		def.Name = def.Kind
+	}
+	p := def.Profile
+	if p.CPUCores < 0 || p.MemoryMB < 0 || p.DiskIOPS < 0 || p.MaxConcurrency < 0 || p.FlushIntervalMs < 0 {
+		return nil, fmt.Errorf("%s: negative profile value", def.Kind)
+	}
+	if p.NetworkMBps < 0 || p.Read.NetworkKB < 0 || p.Write.NetworkKB < 0 {
+		return nil, fmt.Errorf("%s: negative network value", def.Kind)
+	}
+	if p.Read.CPUMs < 0 || p.Write.CPUMs < 0 || p.Read.DiskIOs < 0 || p.Write.DiskIOs < 0 {
+		return nil, fmt.Errorf("%s: negative op cost", def.Kind)
+	}
+	if p.BufferPoolRatio < 0 || p.BufferPoolRatio > 1 || p.DefaultReadRatio < 0 || p.DefaultReadRatio > 1 {
+		return nil, fmt.Errorf("%s: ratios must be within [0, 1]", def.Kind)
+	}
+	switch blocks.Durability(p.Durability) {
+	case "", blocks.DurabilityNone, blocks.DurabilityBatch, blocks.DurabilityPerWrite:
+	default:
+		return nil, fmt.Errorf("%s: unknown durability %q", def.Kind, p.Durability)
+	}
+
+	b := &Block{def: def, profile: blocks.Profile{
+		CPUCores:         p.CPUCores,
+		MemoryMB:         p.MemoryMB,
+		DiskIOPS:         p.DiskIOPS,
+		NetworkMBps:      p.NetworkMBps,
+		Read:             blocks.OpCost(p.Read),
+		Write:            blocks.OpCost(p.Write),
+		MaxConcurrency:   p.MaxConcurrency,
+		BufferPoolRatio:  p.BufferPoolRatio,
+		Durability:       blocks.Durability(p.Durability),
+		FlushIntervalMs:  p.FlushIntervalMs,
+		DefaultReadRatio: p.DefaultReadRatio,
+	}}
+	seen := make(map[string]bool)
+	for _, bd := range def.Behaviors {
+		if seen[bd.Model] {
+			return nil, fmt.Errorf("%s: model %q used twice", def.Kind, bd.Model)
+		}
+		seen[bd.Model] = true
+		m, err := newModel(bd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", def.Kind, err)
+		}
+		b.models = append(b.models, m)
+	}
+	return b, nil
+}
+
+// LoadDir parses every *.json file in dir and registers the block types in
+// blocks.Types, in file name order. A missing directory is not an error.
+// A kind that is already registered, by Go code or another file, is.
+func LoadDir(dir string) ([]*Block, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var loaded []*Block
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		b, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, dup := blocks.ByKind(b.Kind()); dup {
+			return nil, fmt.Errorf("%s: kind %q is already registered", path, b.Kind())
+		}
+		for _, l := range loaded {
+			if l.Kind() == b.Kind() {
+				return nil, fmt.Errorf("%s: kind %q is already registered", path, b.Kind())
+			}
+		}
+		loaded = append(loaded, b)
+	}
+	for _, b := range loaded {
+		blocks.Types = append(blocks.Types, b)
+	}
+	return loaded, nil
+}
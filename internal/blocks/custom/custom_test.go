@@ -0,0 +1,255 @@
+package custom
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+func TestParseBuildsProfileAndBehaviors(t *testing.T) {
+	b, err := Parse([]byte(`{
+		"kind": "in_house_proxy",
+		"name": "In-house Proxy",
+		"category": "traffic",
+		"profile": {"cpu_cores": 2, "memory_mb": 1024, "read": {"cpu_ms": 0.1}, "write": {"cpu_ms": 0.2}},
+		"behaviors": [{"model": "rate_limit", "params": {"limit_rps": 1000}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Kind() != "in_house_proxy" || b.Profile().CPUCores != 2 || b.Profile().Write.CPUMs != 0.2 {
+		t.Errorf("unexpected block %+v", b.Profile())
+	}
+	if b.Describe().Category != "traffic" {
+		t.Errorf("category not carried: %+v", b.Describe())
+	}
+
+	state := map[string]float64{}
+	b.InitState(state)
+	// 1200 RPS against a 1000 RPS limit: fully throttled.
+	e := b.Tick(blocks.TickContext{Reads: 120, Dt: 0.1, State: state})
+	if !e.Saturated || e.CapMultiplier >= 1 || e.Metrics["rate_util"] != 1 {
+		t.Errorf("rate limit should saturate, got %+v", e)
+	}
+}
+
+func TestParseRejectsBadDefinitions(t *testing.T) {
+	for name, def := range map[string]string{
+		"bad kind":      `{"kind": "Bad Kind", "profile": {}}`,
+		"unknown model": `{"kind": "x", "behaviors": [{"model": "magic"}]}`,
+		"unknown param": `{"kind": "x", "behaviors": [{"model": "pool", "params": {"threads": 4}}]}`,
+		"zero pool":     `{"kind": "x", "behaviors": [{"model": "pool", "params": {"size": 0}}]}`,
+		"twice":         `{"kind": "x", "behaviors": [{"model": "pool"}, {"model": "pool"}]}`,
+		"durability":    `{"kind": "x", "profile": {"durability": "eventually"}}`,
+		"ratio":         `{"kind": "x", "profile": {"buffer_pool_ratio": 1.5}}`,
+		"unknown field": `{"kind": "x", "behaviours": [{"model": "pool"}]}`,
+	} {
+		if _, err := Parse([]byte(def)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRateLimitHoldsThroughputToLimit(t *testing.T) {
+	for name, profile := range map[string]ProfileDef{
+		// 50x the limit: the block's own capacity would take it all.
+		"profiled": {CPUCores: 64, MemoryMB: 65536, Read: OpCostDef{CPUMs: 0.01}, Write: OpCostDef{CPUMs: 0.01}},
+		// Nothing but the limit bounds the block, and at 2s ticks its raw
+		// capacity overflows to +Inf.
+		"unprofiled": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := New(Def{
+				Kind:      "test_rate_proxy",
+				Profile:   profile,
+				Behaviors: []BehaviorDef{{Model: "rate_limit", Params: map[string]float64{"limit_rps": 1000}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			types := blocks.Types
+			blocks.Types = append(blocks.Types, b)
+			t.Cleanup(func() { blocks.Types = types })
+			g, err := engine.BuildGraph(engine.Topology{Blocks: []engine.TopoBlock{{ID: "p", Kind: "test_rate_proxy"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := engine.NewSimState(g)
+			state.Dt = 2
+			var dropped float64
+			for range 20 {
+				results, err := engine.SimulateTick(g, 50000, 0.5, state)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rps := results[0].RPS; rps > 1000+1e-6 {
+					t.Fatalf("throughput %g RPS past the 1000 RPS limit", rps)
+				}
+				dropped += results[0].Dropped
+			}
+			if dropped == 0 {
+				t.Error("traffic past the limit should overflow the queue and drop")
+			}
+		})
+	}
+}
+
+func TestWarmupAbsorbsUnderOneRequestPerTick(t *testing.T) {
+	b, err := New(Def{Kind: "x", Behaviors: []BehaviorDef{{Model: "warmup"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := map[string]float64{"warm_ratio": 1}
+	// A fully warm block absorbs every read, however light the tick.
+	e := b.Tick(blocks.TickContext{Reads: 0.05, Dt: 0.001, State: state})
+	if e.AbsorbRatio < 0.99 {
+		t.Errorf("want every read absorbed, got %g", e.AbsorbRatio)
+	}
+}
+
+func TestFillDecayCacheAbsorbsReads(t *testing.T) {
+	b, err := New(Def{Kind: "x", Behaviors: []BehaviorDef{{
+		Model:  "fill_decay",
+		Params: map[string]float64{"capacity_mb": 10, "write_mb": 0.01, "decay_per_tick": 0, "max_hit_ratio": 0.9},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := map[string]float64{}
+	b.InitState(state)
+	var e blocks.TickEffect
+	for range 20 {
+		e = b.Tick(blocks.TickContext{Reads: 900, Writes: 100, Dt: 0.1, State: state})
+	}
+	if e.Metrics["evicting"] != 1 {
+		t.Errorf("memory should be past the eviction threshold, got %+v", e.Metrics)
+	}
+	if e.AbsorbRatio < 0.8 || e.AbsorbRatio > 0.81 {
+		t.Errorf("full cache should absorb 90%% of reads (0.81 of traffic), got %g", e.AbsorbRatio)
+	}
+}
+
+func TestFillDecayUsesMemoryOverride(t *testing.T) {
+	dir := t.TempDir()
+	def := `{
+		"kind": "test_fill_cache",
+		"profile": {"cpu_cores": 4, "memory_mb": 100, "read": {"cpu_ms": 0.01}, "write": {"cpu_ms": 0.01}},
+		"behaviors": [{"model": "fill_decay", "params": {"write_mb": 0.01, "decay_per_tick": 0}}]
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "cache.json"), []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	memoryPct := func(overrides map[string]float64) float64 {
+		g, err := engine.BuildGraph(engine.Topology{Blocks: []engine.TopoBlock{{ID: "c", Kind: "test_fill_cache", Overrides: overrides}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, _ := engine.SimulateTick(g, 100, 0, engine.NewSimState(g))
+		return results[0].Metrics["memory_pct"]
+	}
+	// 10 writes of 0.01 MB fill a tenth of a percent of 100 MB.
+	if base, halved := memoryPct(nil), memoryPct(map[string]float64{engine.ParamMemoryMB: 50}); base != 0.001 || halved != 0.002 {
+		t.Errorf("capacity should follow memory_mb: %g at 100 MB, %g at 50 MB", base, halved)
+	}
+}
+
+func TestPoolScalesWithInstances(t *testing.T) {
+	b, err := New(Def{Kind: "x", Behaviors: []BehaviorDef{{
+		Model:  "pool",
+		Params: map[string]float64{"size": 10, "read_hold_ms": 100},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 100 reads/s held 100ms keep 10 slots busy: one instance is full,
+	// two replicas of two shards are a quarter full.
+	util := func(replicas, shards int) float64 {
+		state := map[string]float64{}
+		b.InitState(state)
+		e := b.Tick(blocks.TickContext{Reads: 10, Dt: 0.1, State: state, Replicas: replicas, Shards: shards})
+		return e.Metrics["pool_util"]
+	}
+	if one, four := util(0, 0), util(2, 2); one != 1 || four != 0.25 {
+		t.Errorf("pool util: want 1 then 0.25, got %g then %g", one, four)
+	}
+}
+
+func TestLoadDirRegistersAndSimulates(t *testing.T) {
+	dir := t.TempDir()
+	def := `{
+		"kind": "test_pool_svc",
+		"name": "Pool Service",
+		"profile": {"cpu_cores": 4, "memory_mb": 4096, "read": {"cpu_ms": 0.1}, "write": {"cpu_ms": 0.1}},
+		"behaviors": [{"model": "pool", "params": {"size": 10, "read_hold_ms": 10, "write_hold_ms": 10}}]
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "svc.json"), []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("want 1 block, got %d", len(loaded))
+	}
+	if _, ok := blocks.ByKind("test_pool_svc"); !ok {
+		t.Fatal("custom block not registered")
+	}
+
+	// A second load of the same kind must not silently shadow the first.
+	if _, err := LoadDir(dir); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("expected duplicate kind error, got %v", err)
+	}
+
+	// 2000 RPS * 10ms hold = 20 slots wanted of 10: the pool saturates.
+	topo := engine.Topology{Blocks: []engine.TopoBlock{{ID: "s", Kind: "test_pool_svc"}}}
+	if r := engine.Validate(topo); !r.OK() {
+		t.Fatalf("custom kind should validate: %+v", r.Errors)
+	}
+	g, _ := engine.BuildGraph(topo)
+	state := engine.NewSimState(g)
+	results, err := engine.SimulateTick(g, 2000, 0.5, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Saturated || results[0].Metrics["pool_util"] != 1 {
+		t.Errorf("pool should saturate, got %+v", results[0])
+	}
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	n := len(blocks.Types)
+	loaded, err := LoadDir(filepath.Join(t.TempDir(), "none"))
+	if err != nil || len(loaded) != 0 || len(blocks.Types) != n {
+		t.Errorf("missing dir should load nothing, got %v, %v", loaded, err)
+	}
+}
+
+func TestExampleDefinitions(t *testing.T) {
+	paths, _ := filepath.Glob("../../../examples/blocks/*.json")
+	if len(paths) == 0 {
+		t.Skip("no examples")
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(data)
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+			continue
+		}
+		if !slices.Contains([]string{"traffic", "compute", "storage", "queue"}, b.Describe().Category) {
+			t.Errorf("%s: unknown category %q", p, b.Describe().Category)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package custom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+// A model is one standard per-tick behavior with its parameters resolved.
+type model interface {
+	init(state map[string]float64)
+	tick(ctx blocks.TickContext) blocks.TickEffect
+}
+
+// modelDefaults lists each model's parameters and their defaults. A parameter
+// missing from the file takes its default; an unknown one is an error.
+var modelDefaults = map[string]map[string]float64{
+	// Worker pool: requests hold a slot for their wall-clock time. Past
+	// threshold utilization, throughput falls and latency climbs.
+	"pool": {
+		"size":          100,
+		"read_hold_ms":  5,
+		"write_hold_ms": 15,
+		"threshold":     0.7,
+		"max_penalty":   0.4,
+		"latency_ms":    1,
+	},
+	// Memory that fills with writes and decays (TTLs, compaction). Past
+	// evict_threshold, eviction steals capacity. With max_hit_ratio > 0 the
+	// block acts as a cache, absorbing reads in proportion to how full it is.
+	// capacity_mb 0 takes the profile's memory_mb, overrides included.
+	"fill_decay": {
+		"capacity_mb":     0,
+		"write_mb":        0.001,
+		"decay_per_tick":  0.01,
+		"evict_threshold": 0.8,
+		"max_penalty":     0.5,
+		"max_hit_ratio":   0,
+		"latency_ms":      1,
+	},
+	// A warm ratio that rises under traffic and cools when idle, boosting
+	// capacity and absorbing reads as it warms (edge caches, JIT, pools).
+	"warmup": {
+		"warm_per_tick": 0.02,
+		"cool_per_tick": 0.005,
+		"cap_boost":     0,
+		"absorb_reads":  1,
+		"latency_ms":    1,
+		"latency_cut":   0.8,
+	},
+	// Throttling against a fixed request rate: past threshold utilization,
+	// capacity and latency suffer, and nothing past limit_rps is processed.
+	"rate_limit": {
+		"limit_rps":   10000,
+		"threshold":   0.8,
+		"max_penalty": 0.5,
+		"latency_ms":  1,
+	},
+}
+
+func newModel(bd BehaviorDef) (model, error) {
+	defaults, ok := modelDefaults[bd.Model]
+	if !ok {
+		names := make([]string, 0, len(modelDefaults))
+		for n := range modelDefaults {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown model %q (want one of %s)", bd.Model, strings.Join(names, ", "))
+	}
+	p := make(map[string]float64, len(defaults))
+	for k, v := range defaults {
+		p[k] = v
+	}
+	for k, v := range bd.Params {
+		if _, ok := defaults[k]; !ok {
+			return nil, fmt.Errorf("model %s: unknown param %q", bd.Model, k)
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("model %s: param %s must not be negative", bd.Model, k)
+		}
+		p[k] = v
+	}
+	for _, k := range []string{"threshold", "evict_threshold"} {
+		if v, ok := p[k]; ok && v >= 1 {
+			return nil, fmt.Errorf("model %s: %s must be below 1", bd.Model, k)
+		}
+	}
+	if v, ok := p["max_penalty"]; ok && v >= 1 {
+		return nil, fmt.Errorf("model %s: max_penalty must be below 1", bd.Model)
+	}
+
+	switch bd.Model {
+	case "pool":
+		if p["size"] <= 0 {
+			return nil, fmt.Errorf("model pool: size must be positive")
+		}
+		return poolModel(p), nil
+	case "fill_decay":
+		return fillDecayModel(p), nil
+	case "warmup":
+		return warmupModel(p), nil
+	default:
+		if p["limit_rps"] <= 0 {
+			return nil, fmt.Errorf("model rate_limit: limit_rps must be positive")
+		}
+		return rateLimitModel(p), nil
+	}
+}
+
+type poolModel map[string]float64
+
+func (poolModel) init(state map[string]float64) { state["pool_active"] = 0 }
+
+func (p poolModel) tick(ctx blocks.TickContext) blocks.TickEffect {
+	readRPS := ctx.Reads / ctx.Dt
+	writeRPS := ctx.Writes / ctx.Dt
+	// size is per instance, like the profile's max_concurrency.
+	size := p["size"] * ctx.Instances()
+	active := math.Min(readRPS*p["read_hold_ms"]/1000+writeRPS*p["write_hold_ms"]/1000, size)
+	ctx.State["pool_active"] = active
+	util := active / size
+
+	e := blocks.TickEffect{
+		CapMultiplier: 1,
+		Latency:       p["latency_ms"],
+		Saturated:     util >= 0.99,
+		Metrics:       map[string]float64{"pool_util": util},
+	}
+	if th := p["threshold"]; util > th {
+		t := (util - th) / (1 - th)
+		e.CapMultiplier = 1 - p["max_penalty"]*t*t
+		e.Latency = p["latency_ms"] * (1 + 2*t*t)
+	}
+	return e
+}
+
+type fillDecayModel map[string]float64
+
+// defaultFillCapacityMB is fill_decay's per-replica capacity when neither the
+// model nor the profile sets one.
+const defaultFillCapacityMB = 1024
+
+func (fillDecayModel) init(state map[string]float64) { state["memory_used_mb"] = 0 }
+
+func (m fillDecayModel) tick(ctx blocks.TickContext) blocks.TickEffect {
+	// capacity_mb is per replica, like the profile's memory_mb, which
+	// arrives already scaled.
+	capacity := m["capacity_mb"] * float64(max(ctx.Replicas, 1))
+	if capacity == 0 {
+		capacity = float64(ctx.Profile.MemoryMB)
+	}
+	if capacity == 0 {
+		capacity = defaultFillCapacityMB * float64(max(ctx.Replicas, 1))
+	}
+	used := ctx.State["memory_used_mb"]
+	used += ctx.Writes * m["write_mb"]
+	used -= used * blocks.Rate(m["decay_per_tick"], ctx.Dt)
+	used = math.Max(0, math.Min(used, capacity))
+	ctx.State["memory_used_mb"] = used
+
+	memPct := used / capacity
+	th := m["evict_threshold"]
+	evicting := 0.0
+	e := blocks.TickEffect{CapMultiplier: 1, Latency: m["latency_ms"]}
+	if memPct > th {
+		evicting = 1
+		pressure := (memPct - th) / (1 - th)
+		e.CapMultiplier = 1 - m["max_penalty"]*pressure
+		e.Latency = m["latency_ms"] * (1 + 3*pressure)
+	}
+	if total := ctx.Reads + ctx.Writes; total > 0 && m["max_hit_ratio"] > 0 {
+		hit := math.Min(memPct/th, m["max_hit_ratio"])
+		e.AbsorbRatio = hit * ctx.Reads / total
+	}
+	e.Metrics = map[string]float64{"memory_pct": memPct, "evicting": evicting}
+	return e
+}
+
+type warmupModel map[string]float64
+
+func (warmupModel) init(state map[string]float64) { state["warm_ratio"] = 0 }
+
+func (m warmupModel) tick(ctx blocks.TickContext) blocks.TickEffect {
+	ratio := ctx.State["warm_ratio"]
+	total := ctx.Reads + ctx.Writes
+	if total > 0 {
+		ratio += blocks.Rate(m["warm_per_tick"], ctx.Dt) * (1 - ratio)
+	} else {
+		ratio -= blocks.Rate(m["cool_per_tick"], ctx.Dt) * ratio
+	}
+	ratio = math.Max(0, math.Min(1, ratio))
+	ctx.State["warm_ratio"] = ratio
+
+	e := blocks.TickEffect{
+		CapMultiplier: 1 + ratio*m["cap_boost"],
+		Latency:       m["latency_ms"] * (1 - math.Min(m["latency_cut"], 1)*ratio),
+		Metrics:       map[string]float64{"warm_ratio": ratio},
+	}
+	if m["absorb_reads"] > 0 {
+		e.AbsorbRatio = ratio * ctx.Reads / math.Max(total, 1e-12)
+	}
+	return e
+}
+
+type rateLimitModel map[string]float64
+
+func (rateLimitModel) init(state map[string]float64) { state["rate_util"] = 0 }
+
+func (m rateLimitModel) tick(ctx blocks.TickContext) blocks.TickEffect {
+	rps := (ctx.Reads + ctx.Writes) / ctx.Dt
+	util := math.Min(rps/m["limit_rps"], 1)
+	ctx.State["rate_util"] = util
+
+	e := blocks.TickEffect{
+		CapMultiplier: 1,
+		Latency:       m["latency_ms"],
+		Saturated:     util > 0.95,
+		Metrics:       map[string]float64{"rate_util": util},
+	}
+	if th := m["threshold"]; util > th {
+		pressure := (util - th) / (1 - th)
+		e.CapMultiplier = 1 - m["max_penalty"]*pressure
+		e.Latency = m["latency_ms"] * (1 + 2*pressure)
+	}
+	// The excess over the limit waits in the block's queue, or is dropped
+	// once the queue overflows. An absolute limit holds even when nothing
+	// else bounds the block's capacity.
+	e.Limit = m["limit_rps"] * ctx.Dt
+	return e
+}
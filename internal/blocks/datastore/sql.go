@@ -8,12 +8,15 @@ import (
 
 const (
 	bTreeReadIOs  = 2
-	bTreeWriteIOs = 6
+	bTreeWriteIOs = 5 // page and WAL writes; the per-write fsync is the 6th
 	bufferPool    = 0.85 // well-tuned shared_buffers
 	maxConns      = 200
 
 	readHoldSec  = 0.002 // 2ms — quick lookup, buffer pool hit
 	writeHoldSec = 0.010 // 10ms — lock, WAL, fsync
+
+	maxLockUtil    = 0.99 // keeps the hot-row wait finite at saturation
+	deadlockFactor = 0.05 // share of hot writes aborted at full lock utilization
 )
 
 type SQL struct{}
@@ -26,8 +29,8 @@ func (SQL) Profile() blocks.Profile {
 		CPUCores: 8,
 		MemoryMB: 32768,
 		DiskIOPS: blocks.SSDDiskIOPS,
-		Read:     blocks.OpCost{CPUMs: 0.5, MemoryMB: 0.5, DiskIOs: bTreeReadIOs},
-		Write:    blocks.OpCost{CPUMs: 1.0, MemoryMB: 0.5, DiskIOs: bTreeWriteIOs},
+		Read:     blocks.OpCost{CPUMs: 0.5, MemoryMB: 0.5, DiskIOs: bTreeReadIOs, NetworkKB: 2},
+		Write:    blocks.OpCost{CPUMs: 1.0, MemoryMB: 0.5, DiskIOs: bTreeWriteIOs, NetworkKB: 1},
 		MaxConcurrency:  maxConns,
 		BufferPoolRatio: bufferPool,
 		Durability:       blocks.DurabilityPerWrite,
@@ -37,19 +40,37 @@ func (SQL) Profile() blocks.Profile {
 
 func (SQL) InitState(state map[string]float64) {
 	state["active_conns"] = 0
+	state["hot_row_queued"] = 0
 }
 
 // Connection pool: reads and writes hold connections for different durations.
 // Write-heavy loads fill the pool much faster (12ms vs 2ms hold).
+//
+// Hot rows: writes to the same row serialize on its lock, so each hot row
+// takes at most one write per writeHoldSec. Their lock wait grows
+// nonlinearly as a row nears that rate, and the waiters keep their
+// connections. Past that rate only the hot writes are held back; they wait
+// in the queue, ahead of the fresh writes' hot share. With deadlocks on,
+// some of them are aborted as victims.
 func (SQL) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	readRPS := ctx.Reads / ctx.Dt
 	writeRPS := ctx.Writes / ctx.Dt
 	readConns := readRPS * readHoldSec
 	writeConns := writeRPS * writeHoldSec
-	active := math.Min(readConns+writeConns, maxConns)
+
+	held := math.Min(ctx.State["hot_row_queued"], ctx.Writes)
+	hotRPS := ((ctx.Writes-held)*ctx.Params[blocks.ParamHotRowFraction] + held) / ctx.Dt
+	ctx.State["hot_row_queued"] = 0
+	lockUtil := hotRPS / math.Max(ctx.Params[blocks.ParamHotRows], 1) * writeHoldSec
+	rho := math.Min(lockUtil, maxLockUtil)
+	lockWait := writeHoldSec * rho / (2 * (1 - rho)) // M/D/1 queue on each row
+	waitConns := hotRPS * lockWait
+
+	conns := float64(ctx.Profile.MaxConcurrency)
+	active := math.Min(readConns+writeConns+waitConns, conns)
 	ctx.State["active_conns"] = active
 
-	poolUtil := active / maxConns
+	poolUtil := active / conns
 	e := blocks.TickEffect{
 		CapMultiplier: 1.0,
 		Metrics:       map[string]float64{"conn_pool_util": poolUtil},
@@ -63,6 +84,26 @@ func (SQL) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	if poolUtil >= 0.99 {
 		e.Saturated = true
 	}
+
+	if hotRPS > 0 {
+		total := ctx.Reads + ctx.Writes
+		// Every request waits its share of the hot writes' lock waits.
+		e.Latency += lockWait * 1000 * hotRPS * ctx.Dt / total
+		if lockUtil > 1 {
+			// The hot rows pass only 1/lockUtil of the writes offered to
+			// them; reads and cold writes go through.
+			blocked := hotRPS * ctx.Dt * (1 - 1/lockUtil)
+			ctx.State["hot_row_queued"] = blocked
+			e.Limit = total - blocked
+			e.Saturated = true
+		}
+		e.Metrics["lock_util"] = lockUtil
+		e.Metrics["lock_wait_ms"] = lockWait * 1000
+		if ctx.Params[blocks.ParamDeadlocks] >= 0.5 {
+			e.AbortRatio = ctx.Params[blocks.ParamHotRowFraction] * deadlockFactor * rho * rho
+			e.Metrics["deadlock_aborts"] = writeRPS * e.AbortRatio
+		}
+	}
 	return e
 }
 
@@ -9,7 +9,7 @@ import (
 const (
 	mongoConnPool     = 500
 	mongoTotalMemMB   = 16384
-	mongoCacheMemMB   = 11468.8 // 70% of total for WiredTiger cache
+	mongoCacheRatio   = 0.7     // WiredTiger cache share of total memory
 	mongoCompactRate  = 0.02    // compaction reclaims 2% per tick
 	mongoWriteAmpIOs  = 4       // write amplification from journaling + oplog
 )
@@ -39,14 +39,15 @@ func (MongoDB) InitState(state map[string]float64) {
 // compaction runs in the background stealing CPU from queries.
 func (MongoDB) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	used := ctx.State["cache_used_mb"]
+	cacheMB := float64(ctx.Profile.MemoryMB) * mongoCacheRatio
 
 	// Writes add to cache, compaction reclaims
-	used += ctx.Writes * 0.5 // MemoryMB per write
-	used -= used * mongoCompactRate
-	used = math.Max(0, math.Min(used, mongoCacheMemMB))
+	used += ctx.Writes * ctx.Profile.Write.MemoryMB
+	used -= used * blocks.Rate(mongoCompactRate, ctx.Dt)
+	used = math.Max(0, math.Min(used, cacheMB))
 	ctx.State["cache_used_mb"] = used
 
-	pressure := used / mongoCacheMemMB
+	pressure := used / cacheMB
 
 	capMult := 1.0
 	latency := 0.3 // base read latency
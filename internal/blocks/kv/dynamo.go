@@ -42,9 +42,9 @@ func (KVStore) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	if ctx.Writes > 0 {
 		// Write intensity relative to capacity drives hotspot buildup
 		writeIntensity := math.Min(ctx.Writes/ctx.RawCap, 1.0)
-		pressure += kvHotspotBuildup * writeIntensity
+		pressure += blocks.Rate(kvHotspotBuildup, ctx.Dt) * writeIntensity
 	}
-	pressure -= kvHotspotDecay * pressure
+	pressure -= blocks.Rate(kvHotspotDecay, ctx.Dt) * pressure
 	pressure = math.Max(0, math.Min(1, pressure))
 	ctx.State["hotspot_pressure"] = pressure
 
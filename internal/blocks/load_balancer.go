@@ -31,7 +31,8 @@ func (LoadBalancer) InitState(state map[string]float64) {
 // table. When the table fills, new connections stall.
 func (LoadBalancer) Tick(ctx TickContext) TickEffect {
 	totalRPS := (ctx.Reads + ctx.Writes) / ctx.Dt
-	connUtil := math.Min(totalRPS/lbMaxConnTable, 1.0)
+	// Each replica keeps its own connection table.
+	connUtil := math.Min(totalRPS/(lbMaxConnTable*float64(max(ctx.Replicas, 1))), 1.0)
 	ctx.State["conn_track_util"] = connUtil
 
 	capMult := 1.0
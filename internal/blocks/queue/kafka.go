@@ -10,7 +10,7 @@ const (
 	appendLogIOs    = 1
 	cpuPerOp        = 0.02
 	brokerConns     = 10000
-	pageCacheMemMB  = 32768.0 // total page cache available
+	pageCacheMemMB  = 32768 // total page cache available
 	pageCacheFillMB = 0.01    // MB per write filling page cache
 	pageCacheDecay  = 0.02    // 2% natural eviction per tick
 )
@@ -23,10 +23,10 @@ func (Kafka) Name() string { return "Kafka" }
 func (Kafka) Profile() blocks.Profile {
 	return blocks.Profile{
 		CPUCores: 4,
-		MemoryMB: 32768,
+		MemoryMB: pageCacheMemMB,
 		DiskIOPS: blocks.SSDDiskIOPS,
-		Read:     blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: 0.01, DiskIOs: appendLogIOs, Sequential: true},
-		Write:    blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: 0.01, DiskIOs: appendLogIOs, Sequential: true},
+		Read:     blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: 0.01, DiskIOs: appendLogIOs, Sequential: true, NetworkKB: 1},
+		Write:    blocks.OpCost{CPUMs: cpuPerOp, MemoryMB: 0.01, DiskIOs: appendLogIOs, Sequential: true, NetworkKB: 1},
 		MaxConcurrency: brokerConns,
 		Durability:       blocks.DurabilityBatch,
 		DefaultReadRatio: 0.1,
@@ -41,13 +41,14 @@ func (Kafka) InitState(state map[string]float64) {
 // recent data hit cache (fast); when cache is full, reads fall to disk.
 func (Kafka) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	used := ctx.State["page_cache_used"]
+	cacheMB := float64(ctx.Profile.MemoryMB)
 
 	used += ctx.Writes * pageCacheFillMB
-	used -= used * pageCacheDecay
-	used = math.Max(0, math.Min(used, pageCacheMemMB))
+	used -= used * blocks.Rate(pageCacheDecay, ctx.Dt)
+	used = math.Max(0, math.Min(used, cacheMB))
 	ctx.State["page_cache_used"] = used
 
-	cacheUtil := used / pageCacheMemMB
+	cacheUtil := used / cacheMB
 
 	capMult := 1.0
 	latency := cpuPerOp * 1000 // base latency
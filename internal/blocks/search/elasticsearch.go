@@ -31,6 +31,7 @@ func (Elasticsearch) Profile() blocks.Profile {
 		MaxConcurrency:  threadPool,
 		BufferPoolRatio: bufferPool,
 		Durability:       blocks.DurabilityBatch,
+		FlushIntervalMs:  5000, // async translog, 5s sync interval
 		DefaultReadRatio: 0.8,
 	}
 }
@@ -45,11 +46,13 @@ func (Elasticsearch) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	segs := ctx.State["segment_count"]
 
 	segs += ctx.Writes * segmentsPerWrite
-	segs -= segs * mergeRate
-	segs = math.Max(0, math.Min(segs, maxSegments))
+	segs -= segs * blocks.Rate(mergeRate, ctx.Dt)
+	// Every shard merges its own segments; replicas index every write.
+	limit := maxSegments * float64(max(ctx.Shards, 1))
+	segs = math.Max(0, math.Min(segs, limit))
 	ctx.State["segment_count"] = segs
 
-	pressure := segs / maxSegments
+	pressure := segs / limit
 
 	capMult := 1.0
 	latency := 1.0 // base query latency
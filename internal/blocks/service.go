@@ -20,8 +20,8 @@ func (Service) Profile() Profile {
 	return Profile{
 		CPUCores:       4,
 		MemoryMB:       svcMemMB,
-		Read:           OpCost{CPUMs: 0.2, MemoryMB: svcReadMemMB},
-		Write:          OpCost{CPUMs: 1.0, MemoryMB: svcWriteMemMB},
+		Read:           OpCost{CPUMs: 0.2, MemoryMB: svcReadMemMB, NetworkKB: 4},
+		Write:          OpCost{CPUMs: 1.0, MemoryMB: svcWriteMemMB, NetworkKB: 8},
 		MaxConcurrency: goroutinePool,
 	}
 }
@@ -36,14 +36,15 @@ func (Service) Tick(ctx TickContext) TickEffect {
 	total := ctx.Reads + ctx.Writes
 	readRPS := ctx.Reads / ctx.Dt
 	writeRPS := ctx.Writes / ctx.Dt
-	active := math.Min(readRPS*svcReadHoldSec+writeRPS*svcWriteHoldSec, goroutinePool)
+	pool := float64(ctx.Profile.MaxConcurrency)
+	active := math.Min(readRPS*svcReadHoldSec+writeRPS*svcWriteHoldSec, pool)
 	ctx.State["active_goroutines"] = active
 
 	readRatio := ctx.Reads / math.Max(total, 1)
-	memPerReq := svcReadMemMB*readRatio + svcWriteMemMB*(1-readRatio)
-	memPressure := active * memPerReq / svcMemMB
+	memPerReq := ctx.Profile.Read.MemoryMB*readRatio + ctx.Profile.Write.MemoryMB*(1-readRatio)
+	memPressure := active * memPerReq / float64(ctx.Profile.MemoryMB)
 
-	poolUtil := active / goroutinePool
+	poolUtil := active / pool
 	e := TickEffect{
 		CapMultiplier: 1.0,
 		Metrics: map[string]float64{
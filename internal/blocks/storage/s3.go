@@ -41,7 +41,7 @@ func (S3) Tick(ctx blocks.TickContext) blocks.TickEffect {
 	throughputMB := ctx.Reads*s3ReadMB + ctx.Writes*s3WriteMB
 	// Convert per-tick to per-second
 	mbps := throughputMB / ctx.Dt
-	bwUtil := math.Min(mbps/s3BandwidthMBps, 1.0)
+	bwUtil := math.Min(mbps/(s3BandwidthMBps*float64(max(ctx.Replicas, 1))), 1.0)
 	ctx.State["bandwidth_util"] = bwUtil
 
 	capMult := 1.0
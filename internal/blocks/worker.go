@@ -37,14 +37,15 @@ func (Worker) Tick(ctx TickContext) TickEffect {
 	total := ctx.Reads + ctx.Writes
 	readRPS := ctx.Reads / ctx.Dt
 	writeRPS := ctx.Writes / ctx.Dt
-	active := math.Min(readRPS*workerReadHoldSec+writeRPS*workerWriteHoldSec, workerThreads)
+	threads := float64(ctx.Profile.MaxConcurrency)
+	active := math.Min(readRPS*workerReadHoldSec+writeRPS*workerWriteHoldSec, threads)
 	ctx.State["active_threads"] = active
 
 	readRatio := ctx.Reads / math.Max(total, 1)
-	memPerReq := workerReadMemMB*readRatio + workerWriteMemMB*(1-readRatio)
-	memPressure := active * memPerReq / workerMemMB
+	memPerReq := ctx.Profile.Read.MemoryMB*readRatio + ctx.Profile.Write.MemoryMB*(1-readRatio)
+	memPressure := active * memPerReq / float64(ctx.Profile.MemoryMB)
 
-	poolUtil := active / workerThreads
+	poolUtil := active / threads
 	e := TickEffect{
 		CapMultiplier: 1.0,
 		Metrics: map[string]float64{
@@ -0,0 +1,106 @@
+package engine
+
+import "strings"
+
+// consumerPullUtil is how far consumers fill themselves from a backlog: up to
+// 80% of capacity, short of where contention bites hard.
+const consumerPullUtil = 0.8
+
+// Engine-owned BlockState.Extra keys. A producer keeps one backlog per async
+// edge, keyed by consumer; the consumer keeps its lag in seconds.
+const (
+	backlogPrefix      = "backlog:"
+	backlogReadsPrefix = "backlog_reads:" // reads among the backlog
+	stateLagSec        = "consumer_lag_s"
+)
+
+func backlogKey(to string) string      { return backlogPrefix + to }
+func backlogReadsKey(to string) string { return backlogReadsPrefix + to }
+
+// pullBacklogs moves up to room requests from the backlogs of node's async
+// producers, in edge order, and returns what it took. Backlogs on dead
+// producers are unreachable until they come back.
+func pullBacklogs(g *Graph, state *SimState, node *Node, room float64) flow {
+	var pulled flow
+	for _, from := range node.asyncFrom {
+		if g.nodes[from].Dead || room <= pulled.total() {
+			continue
+		}
+		src := state.Blocks[from].Extra
+		backlog := src[backlogKey(node.ID)]
+		n := min(backlog, room-pulled.total())
+		if n <= 0 {
+			continue
+		}
+		reads := src[backlogReadsKey(node.ID)] * n / backlog
+		src[backlogKey(node.ID)] -= n
+		src[backlogReadsKey(node.ID)] -= reads
+		pulled = flow{pulled.reads + reads, pulled.writes + n - reads}
+	}
+	return pulled
+}
+
+// consumerLag returns node's remaining backlog in messages and seconds. Lag in
+// seconds is the time to drain at this tick's pull rate; while nothing is
+// pulled it grows with simulated time.
+func consumerLag(state *SimState, node *Node, pulled, dt float64) (msgs, secs float64) {
+	for _, from := range node.asyncFrom {
+		msgs += state.Blocks[from].Extra[backlogKey(node.ID)]
+	}
+	bs := state.Blocks[node.ID]
+	switch {
+	case msgs < 0.5:
+		secs = 0
+	case pulled > 0:
+		secs = msgs / (pulled / dt)
+	default:
+		secs = bs.Extra[stateLagSec] + dt
+	}
+	bs.Extra[stateLagSec] = secs
+	return msgs, secs
+}
+
+// backlogged reports whether node's state holds work the graph can still
+// deliver: a backlog on one of its async edges, while both ends are up, or
+// writes buffered for a write-behind store. A backlog on a dead producer or
+// consumer waits for it to come back and does not hold up draining.
+func backlogged(g *Graph, node *Node, extra map[string]float64) bool {
+	for _, oe := range node.outgoing {
+		switch to := g.nodes[oe.To]; {
+		case oe.Async:
+			if !node.Dead && !(to.Dead && !to.replicated()) && extra[backlogKey(oe.To)] > 0.5 {
+				return true
+			}
+		case oe.Cache == WriteBehind:
+			if extra[writeBehindKey(oe.To)] > 0.5 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneBacklogs drops the backlogs and write-behind buffers of edges g does
+// not have, carried over from an earlier topology, which nothing would ever
+// deliver.
+func pruneBacklogs(g *Graph, state *SimState) {
+	for id, bs := range state.Blocks {
+		keep := make(map[string]bool)
+		for _, oe := range g.nodes[id].outgoing {
+			if oe.Async {
+				keep[backlogKey(oe.To)] = true
+				keep[backlogReadsKey(oe.To)] = true
+			}
+			if oe.Cache == WriteBehind {
+				keep[writeBehindKey(oe.To)] = true
+			}
+		}
+		for k := range bs.Extra {
+			delivered := strings.HasPrefix(k, backlogPrefix) || strings.HasPrefix(k, backlogReadsPrefix) ||
+				strings.HasPrefix(k, writeBehindPrefix)
+			if delivered && !keep[k] {
+				delete(bs.Extra, k)
+			}
+		}
+	}
+}
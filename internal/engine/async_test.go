@@ -0,0 +1,131 @@
+package engine
+
+import "testing"
+
+func asyncGraph(t *testing.T) *Graph {
+	t.Helper()
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "k", Kind: "kafka"}, {ID: "w", Kind: "worker"}},
+		Edges: []TopoEdge{
+			{From: "u", To: "k"},
+			{From: "k", To: "w", LatencyMs: 50, Async: true},
+		},
+	})
+}
+
+func TestAsyncEdgeLevelsLoad(t *testing.T) {
+	g := asyncGraph(t)
+	w := g.Node("w")
+	workerCap := nodeCapacity(w, 0.5)
+	state := NewSimState(g)
+
+	// A burst at twice the worker's capacity piles up in Kafka, not the worker.
+	var results []BlockResult
+	for range 50 {
+		results, _ = SimulateTick(g, workerCap*2, 0.5, state)
+	}
+	wr := results[2]
+	if wr.Dropped > 0 || wr.QueueDepth > 0.5 {
+		t.Errorf("worker should pull, not queue: %+v", wr)
+	}
+	if wr.RPS > workerCap*consumerPullUtil*1.001 {
+		t.Errorf("worker should pull at most %g RPS, got %g", workerCap*consumerPullUtil, wr.RPS)
+	}
+	lag, lagSec := wr.Metrics["consumer_lag"], wr.Metrics["consumer_lag_s"]
+	if lag <= 0 || !approx(lagSec, lag/wr.RPS) {
+		t.Errorf("lag should build: %g messages, %gs", lag, lagSec)
+	}
+	if wr.PathLatency != wr.Latency {
+		t.Errorf("async edge should not carry producer latency: path %g, own %g", wr.PathLatency, wr.Latency)
+	}
+	if state.AllDrained(g) {
+		t.Error("state with a backlog should not be drained")
+	}
+
+	// Once the burst passes, the worker drains the backlog.
+	for range 500 {
+		results, _ = SimulateTick(g, workerCap/4, 0.5, state)
+	}
+	if wr := results[2]; wr.Metrics["consumer_lag"] > 0.5 || wr.Metrics["consumer_lag_s"] != 0 {
+		t.Errorf("backlog should drain: %v", wr.Metrics)
+	}
+}
+
+func TestAsyncEdgeEndsSteadyStatePath(t *testing.T) {
+	results, err := Simulate(asyncGraph(t), 100, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := results[2]; w.RPS != 100 || w.PathLatency != w.Latency {
+		t.Errorf("the worker should take the load without the producer's latency: rps %g, path %g, own %g",
+			w.RPS, w.PathLatency, w.Latency)
+	}
+}
+
+func TestAsyncBacklogSurvivesDeadConsumer(t *testing.T) {
+	g := asyncGraph(t)
+	state := NewSimState(g)
+	g.Node("w").Dead = true
+	for range 10 {
+		SimulateTick(g, 100, 0.5, state)
+	}
+	g.Node("w").Dead = false
+	results, _ := SimulateTick(g, 0, 0.5, state)
+	// 1s at 100 RPS waited in Kafka and is delivered once the worker returns.
+	if results[2].RPS*state.Dt < 99 {
+		t.Errorf("revived worker should consume the backlog, got %g RPS", results[2].RPS)
+	}
+}
+
+func TestPausedSimDrainsAfterAsyncEdgeRemoved(t *testing.T) {
+	topo := Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "k", Kind: "kafka"}, {ID: "w", Kind: "worker"}},
+		Edges:  []TopoEdge{{From: "u", To: "k"}, {From: "k", To: "w", Async: true}},
+		RPS:    2 * nodeCapacity(asyncGraph(t).Node("w"), 0.5),
+	}
+	for name, change := range map[string]func(*Topology){
+		"edge removed":  func(topo *Topology) { topo.Edges = topo.Edges[:1] },
+		"producer dead": func(topo *Topology) { topo.Blocks[1].Dead = true },
+	} {
+		sim := NewSim()
+		if err := sim.Play(topo); err != nil {
+			t.Fatal(err)
+		}
+		sim.Freeze()
+		sim.Step(20)
+		if sim.state.Blocks["k"].Extra[backlogKey("w")] < 1 {
+			t.Fatalf("%s: the worker should fall behind", name)
+		}
+		sim.Pause()
+		changed := topo
+		changed.Blocks = append([]TopoBlock(nil), topo.Blocks...)
+		change(&changed)
+		if err := sim.UpdateTopology(changed); err != nil {
+			t.Fatal(err)
+		}
+		if tr, err := sim.Step(10); err != nil || !tr.Done {
+			t.Errorf("%s: a backlog nothing can pull should not hold the sim open, done=%v err=%v", name, tr.Done, err)
+		}
+		sim.Stop()
+	}
+}
+
+func TestRestoredSnapshotDropsStaleBacklogs(t *testing.T) {
+	g := asyncGraph(t)
+	state := NewSimState(g)
+	for range 20 {
+		SimulateTick(g, 2*nodeCapacity(g.Node("w"), 0.5), 0.5, state)
+	}
+	snap := &Snapshot{Blocks: state.Blocks}
+	plain := mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "k", Kind: "kafka"}, {ID: "w", Kind: "worker"}},
+		Edges:  []TopoEdge{{From: "u", To: "k"}, {From: "k", To: "w"}},
+	})
+	restored, err := snap.state(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.Blocks["k"].Extra[backlogKey("w")]; ok || !restored.AllDrained(plain) {
+		t.Errorf("a backlog for an edge that is no longer async should be dropped, got %v", restored.Blocks["k"].Extra)
+	}
+}
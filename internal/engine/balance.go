@@ -0,0 +1,480 @@
+package engine
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Load-balancing algorithms an edge, or a block for all its outgoing edges,
+// spreads traffic over the target's replicas with.
+const (
+	BalanceRoundRobin     = "round-robin"
+	BalanceRandom         = "random"
+	BalanceLeastConn      = "least-connections"
+	BalanceP2C            = "power-of-two-choices"
+	BalanceConsistentHash = "consistent-hash"
+)
+
+const (
+	// ringVnodes is how many points a replica of size 1 places on the
+	// consistent-hash ring.
+	ringVnodes = 100
+
+	// p2cRounds is how many slices a tick's power-of-two-choices traffic is
+	// routed in, each seeing the loads the slices before it left.
+	p2cRounds = 16
+)
+
+// Engine-owned BlockState.Extra key prefixes for per-replica queues.
+const (
+	replicaQueuePrefix      = "replica_queue:"
+	replicaQueueReadsPrefix = "replica_queue_reads:"
+)
+
+// ReplicaResult is one replica's load in a tick.
+type ReplicaResult struct {
+	Size       float64 `json:"size"`
+	Util       float64 `json:"util"`
+	QueueDepth float64 `json:"queue_depth"`
+	Dropped    float64 `json:"dropped"`
+	Latency    float64 `json:"latency"`
+	Down       bool    `json:"down,omitempty"`
+	Evicted    bool    `json:"evicted,omitempty"` // taken out of rotation by health checks
+}
+
+func checkBalance(algo string) error {
+	switch algo {
+	case "", BalanceRoundRobin, BalanceRandom, BalanceLeastConn, BalanceP2C, BalanceConsistentHash:
+		return nil
+	}
+	return fmt.Errorf("unknown balance %q (want round-robin, random, least-connections, power-of-two-choices or consistent-hash)", algo)
+}
+
+// edgeBalance is the algorithm an edge balances with: its own, or else its
+// source block's. Async edges are pulled by the consumer and never balanced.
+func edgeBalance(e TopoEdge, from TopoBlock) string {
+	if e.Async {
+		return ""
+	}
+	if e.Balance != "" {
+		return e.Balance
+	}
+	return from.Balance
+}
+
+// checkReplicas rejects replica sizes and down replicas the engine cannot
+// use; a replica count below one runs as one. Balancing over a primary and
+// its read replicas is left to the replication model.
+func checkReplicas(b TopoBlock) error {
+	for _, s := range b.ReplicaSizes {
+		if math.IsNaN(s) || s <= 0 {
+			return fmt.Errorf("replica size %g not above 0", s)
+		}
+	}
+	if b.DownReplicas < 0 || b.DownReplicas > max(b.Replicas, 1) {
+		return fmt.Errorf("down_replicas = %d outside [0, %d]", b.DownReplicas, max(b.Replicas, 1))
+	}
+	if (len(b.ReplicaSizes) > 0 || b.DownReplicas > 0) && b.Replication != nil {
+		return fmt.Errorf("replica_sizes and down_replicas cannot be combined with replication")
+	}
+	return nil
+}
+
+// checkShards rejects per-replica sizes and outages on skewed shards, which
+// are left out of the skewed-shard model. A shard count below one runs as one.
+func checkShards(b TopoBlock) error {
+	if (len(b.ReplicaSizes) > 0 || b.DownReplicas > 0) && b.ShardSkew != nil {
+		return fmt.Errorf("replica_sizes and down_replicas cannot be combined with shard_skew")
+	}
+	return nil
+}
+
+// checkBalanceTarget rejects a balanced or health-checked edge into a block
+// whose replicas are already split by replication or shard skew.
+func checkBalanceTarget(algo string, hc *HealthCheck, to TopoBlock) error {
+	if (algo != "" || hc != nil) && (to.Replication != nil || to.ShardSkew != nil) {
+		return fmt.Errorf("cannot balance over %q, whose replicas are replicated or skewed", to.ID)
+	}
+	return nil
+}
+
+// balanced reports whether the node's replicas are simulated one by one:
+// traffic reaches it through a load-balancing algorithm or health checks, or
+// its replicas differ in size or some are down.
+func (n *Node) balanced() bool {
+	return n.Replicas > 1 && (n.balancedIn || len(n.ReplicaSizes) > 0 || n.DownReplicas > 0 || n.healthCheck != nil) &&
+		!n.replicated() && !n.skewed()
+}
+
+// replicaDown reports whether replica i is down; the last DownReplicas are.
+func replicaDown(node *Node, i int) bool {
+	return i >= node.Replicas-node.DownReplicas
+}
+
+// replicaSizes is each replica's capacity relative to the profile's; missing
+// sizes are 1.
+func replicaSizes(node *Node) []float64 {
+	s := make([]float64, node.Replicas)
+	for i := range s {
+		s[i] = 1
+		if i < len(node.ReplicaSizes) {
+			s[i] = node.ReplicaSizes[i]
+		}
+	}
+	return s
+}
+
+// balance spreads the fresh traffic arriving by each algorithm over replicas
+// holding load (queued requests) with capacities caps. Traffic without an
+// algorithm goes round-robin. Fixed schemes go first; least-connections and
+// power-of-two-choices then route around the load those left. A tick above 0
+// draws random's noise for that tick; 0 takes its expectation. Only replicas
+// in rotation are picked, or all of them when none is.
+func balance(node *Node, fresh map[string]flow, load, caps []float64, rotation []bool, tick int) []flow {
+	arrive := make([]flow, len(caps))
+	load = slices.Clone(load)
+	var idx []int
+	for i, in := range rotation {
+		if in {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 {
+		for i := range caps {
+			idx = append(idx, i)
+		}
+	}
+	pick := func(xs []float64) []float64 {
+		out := make([]float64, len(idx))
+		for k, i := range idx {
+			out[k] = xs[i]
+		}
+		return out
+	}
+	add := func(f flow, shares []float64) {
+		for k, s := range shares {
+			i := idx[k]
+			arrive[i] = flow{arrive[i].reads + f.reads*s, arrive[i].writes + f.writes*s}
+			load[i] += f.total() * s
+		}
+	}
+	for _, algo := range []string{"", BalanceRoundRobin, BalanceRandom, BalanceConsistentHash, BalanceLeastConn, BalanceP2C} {
+		f := fresh[algo]
+		if f.total() <= 0 {
+			continue
+		}
+		switch algo {
+		case "", BalanceRoundRobin:
+			add(f, evenShares(len(idx)))
+		case BalanceRandom:
+			add(f, randomShares(node, idx, f.total(), tick))
+		case BalanceConsistentHash:
+			add(f, ringShares(node, idx))
+		case BalanceLeastConn:
+			add(f, fillShares(pick(load), pick(caps), f.total()))
+		case BalanceP2C:
+			for range p2cRounds {
+				add(f.scale(1.0/p2cRounds), p2cShares(pick(load), pick(caps)))
+			}
+		}
+	}
+	return arrive
+}
+
+func evenShares(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = 1 / float64(n)
+	}
+	return s
+}
+
+// randomShares is what picking one of the replicas idx at random sends each
+// for requests requests: an even share off by binomial noise, drawn from a
+// hash of the node and tick so runs repeat.
+func randomShares(node *Node, idx []int, requests float64, tick int) []float64 {
+	n := len(idx)
+	s := evenShares(n)
+	if tick <= 0 {
+		return s
+	}
+	p := 1 / float64(n)
+	sd := math.Sqrt(p * (1 - p) / math.Max(requests, 1))
+	var sum float64
+	for i := range s {
+		u1 := unitHash(node.ID, "random", strconv.Itoa(tick), strconv.Itoa(idx[i]), "a")
+		u2 := unitHash(node.ID, "random", strconv.Itoa(tick), strconv.Itoa(idx[i]), "b")
+		z := math.Sqrt(-2*math.Log(math.Max(u1, 1e-300))) * math.Cos(2*math.Pi*u2)
+		s[i] = max(0, p+sd*z)
+		sum += s[i]
+	}
+	for i := range s {
+		s[i] /= sum
+	}
+	return s
+}
+
+// ringShares is the part of the key space each of the replicas idx owns on a
+// consistent-hash ring, with vnodes in proportion to its size. Keys hash to
+// the next vnode clockwise, so a replica leaving the ring hands its keys to
+// its neighbours and the rest keep theirs.
+func ringShares(node *Node, idx []int) []float64 {
+	type vnode struct {
+		at      float64
+		replica int
+	}
+	var ring []vnode
+	sizes := replicaSizes(node)
+	for k, i := range idx {
+		for v := range max(1, int(math.Round(sizes[i]*ringVnodes))) {
+			ring = append(ring, vnode{unitHash(node.ID, strconv.Itoa(i), strconv.Itoa(v)), k})
+		}
+	}
+	slices.SortFunc(ring, func(a, b vnode) int { return cmp.Compare(a.at, b.at) })
+	s := make([]float64, len(idx))
+	prev := ring[len(ring)-1].at - 1
+	for _, v := range ring {
+		s[v.replica] += v.at - prev
+		prev = v.at
+	}
+	return s
+}
+
+// fillShares sends total to the replicas that would drain soonest, evening
+// out load/cap like least-connections does: a busy or small replica holds its
+// connections longer and is picked less.
+func fillShares(load, caps []float64, total float64) []float64 {
+	lo, hi := 0.0, 0.0
+	var capSum float64
+	for i := range caps {
+		hi = max(hi, load[i]/caps[i])
+		capSum += caps[i]
+	}
+	hi += total / capSum
+	for range 100 {
+		level := (lo + hi) / 2
+		var need float64
+		for i := range caps {
+			need += max(0, level*caps[i]-load[i])
+		}
+		if need > total {
+			hi = level
+		} else {
+			lo = level
+		}
+	}
+	s := make([]float64, len(caps))
+	var sum float64
+	for i := range caps {
+		s[i] = max(0, hi*caps[i]-load[i])
+		sum += s[i]
+	}
+	for i := range s {
+		s[i] /= sum
+	}
+	return s
+}
+
+// p2cShares is how often each replica wins when two distinct replicas are
+// drawn at random and the less loaded one (by load/cap) is picked. Ties split
+// their wins.
+func p2cShares(load, caps []float64) []float64 {
+	n := len(caps)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	busy := func(i int) float64 { return load[i] / caps[i] }
+	slices.SortStableFunc(idx, func(a, b int) int { return cmp.Compare(busy(a), busy(b)) })
+	s := make([]float64, n)
+	for k := 0; k < n; {
+		// The j-th least loaded wins against every replica after it.
+		j, win := k, 0.0
+		for ; j < n && busy(idx[j]) == busy(idx[k]); j++ {
+			win += 2 * float64(n-1-j) / float64(n*(n-1))
+		}
+		for ; k < j; k++ {
+			s[idx[k]] = win / float64(j-k)
+		}
+	}
+	return s
+}
+
+// addBalanced records the part of an edge's traffic its algorithm balances.
+func addBalanced(balancing map[string]map[string]flow, oe OutEdge, out flow) {
+	if oe.Balance == "" {
+		return
+	}
+	if balancing[oe.To] == nil {
+		balancing[oe.To] = make(map[string]flow)
+	}
+	f := balancing[oe.To][oe.Balance]
+	balancing[oe.To][oe.Balance] = flow{f.reads + out.reads, f.writes + out.writes}
+}
+
+// processReplicas runs one tick of the node's replicas as separate queues,
+// each with an even split of rawCap scaled by its size, fed by balance.
+// byAlgo is what arrived this tick by algorithm; the rest of in beyond queued
+// arrived without one. Down replicas still get their share unless they are out
+// of rotation, and lose it. It returns what the replicas processed and
+// dropped, each replica's load and its capacity per tick.
+func processReplicas(node *Node, bs *BlockState, in, queued flow, byAlgo map[string]flow, rawCap float64, rotation []bool, tick int) (flow, float64, []partLoad, []float64) {
+	sizes := replicaSizes(node)
+	caps := make([]float64, len(sizes))
+	spread := make([]float64, len(sizes))
+	load := make([]float64, len(sizes))
+	var sizeSum float64
+	for _, s := range sizes {
+		sizeSum += s
+	}
+	for i, s := range sizes {
+		caps[i] = rawCap / float64(len(sizes)) * s
+		spread[i] = s / sizeSum
+		load[i] = bs.Extra[replicaQueuePrefix+strconv.Itoa(i)]
+	}
+	fresh := map[string]flow{}
+	plain := flow{in.reads - queued.reads, in.writes - queued.writes}
+	for algo, f := range byAlgo {
+		fresh[algo] = f
+		plain = flow{plain.reads - f.reads, plain.writes - f.writes}
+	}
+	fresh[""] = flow{max(0, plain.reads), max(0, plain.writes)}
+	arrive := balance(node, fresh, load, caps, rotation, tick)
+	up := slices.Clone(caps)
+	for i := range up {
+		if replicaDown(node, i) {
+			up[i] = 0
+		}
+	}
+	done, dropped, parts := processParts(bs, replicaQueuePrefix, replicaQueueReadsPrefix, queued, spread, arrive, up)
+	return done, dropped, parts, caps
+}
+
+// replicaResults reports each replica's load. A replica's latency is the
+// block's stretched by its own contention, plus the wait for its queue.
+func replicaResults(node *Node, parts []partLoad, caps []float64, rotation []bool, latency, dt float64) []ReplicaResult {
+	sizes := replicaSizes(node)
+	rs := make([]ReplicaResult, len(parts))
+	for i, p := range parts {
+		rs[i] = ReplicaResult{
+			Size:       sizes[i],
+			Util:       p.util,
+			QueueDepth: p.queue,
+			Dropped:    p.dropped,
+			Down:       replicaDown(node, i),
+			Evicted:    !rotation[i],
+		}
+		if !rs[i].Down {
+			rs[i].Latency = latency/contentionFactor(p.util) + p.queue/caps[i]*dt*1000
+		}
+	}
+	return rs
+}
+
+// replicaSpread is how unevenly the serving replicas are loaded, as the
+// busiest one's utilization over the mean, and the p99 latency over the
+// requests they processed.
+func replicaSpread(rs []ReplicaResult, parts []partLoad) (imbalance, tailMs float64) {
+	var sum, busiest, total float64
+	var serving int
+	for i, r := range rs {
+		total += parts[i].processed
+		if r.Down || r.Evicted {
+			continue
+		}
+		sum += r.Util
+		busiest = max(busiest, r.Util)
+		serving++
+	}
+	imbalance = 1
+	if sum > 0 {
+		imbalance = busiest / (sum / float64(serving))
+	}
+	idx := make([]int, len(rs))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortFunc(idx, func(a, b int) int { return cmp.Compare(rs[a].Latency, rs[b].Latency) })
+	var seen float64
+	for _, i := range idx {
+		tailMs = rs[i].Latency
+		if seen += parts[i].processed; seen >= 0.99*total {
+			break
+		}
+	}
+	return imbalance, tailMs
+}
+
+// replicaHealth rescales the node's utilizations, which the pooled profile
+// counts over equal replicas, to the sizes of those up and raises its
+// bottleneck to its busiest replica's.
+func replicaHealth(br *BlockResult, node *Node, rs []ReplicaResult) {
+	var sum float64
+	for i, s := range replicaSizes(node) {
+		if !replicaDown(node, i) {
+			sum += s
+		}
+	}
+	k := float64(node.Replicas) / max(sum, 1e-12)
+	br.CPUUtil *= k
+	br.MemUtil *= k
+	br.DiskUtil *= k
+	br.NetUtil *= k
+	br.Bottleneck = max(br.CPUUtil, br.MemUtil, br.DiskUtil, br.NetUtil)
+	for _, r := range rs {
+		br.Bottleneck = max(br.Bottleneck, r.Util)
+	}
+	br.Health = healthFor(br.Bottleneck)
+}
+
+// staticReplicas is, for Simulate, how many times the pooled utilization the
+// busiest replica runs at in steady state with empty queues, and the traffic
+// lost to down replicas. Health checks have long since taken down replicas
+// out of rotation; without them they keep their share.
+func staticReplicas(node *Node, byAlgo map[string]flow, in flow) (hot float64, lost flow) {
+	sizes := replicaSizes(node)
+	fresh := map[string]flow{}
+	plain := in
+	for algo, f := range byAlgo {
+		fresh[algo] = f
+		plain = flow{plain.reads - f.reads, plain.writes - f.writes}
+	}
+	fresh[""] = flow{max(0, plain.reads), max(0, plain.writes)}
+	rotation := make([]bool, len(sizes))
+	for i := range rotation {
+		rotation[i] = node.healthCheck == nil || !replicaDown(node, i)
+	}
+	arrive := balance(node, fresh, make([]float64, len(sizes)), sizes, rotation, 0)
+	for i, a := range arrive {
+		if replicaDown(node, i) {
+			lost = flow{lost.reads + a.reads, lost.writes + a.writes}
+			continue
+		}
+		hot = max(hot, a.total()/sizes[i])
+	}
+	if in.total() <= 0 {
+		return 1, lost
+	}
+	return hot * float64(len(sizes)) / in.total(), lost
+}
+
+// unitHash maps its parts to [0, 1).
+func unitHash(parts ...string) float64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	// FNV barely mixes its last bytes into the high bits; finish it off.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+func balancedGraph(t *testing.T, algo string, sizes []float64) *Graph {
+	t.Helper()
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "lb", Kind: "load_balancer", Balance: algo},
+			{ID: "svc", Kind: "service", Replicas: 3, ReplicaSizes: sizes},
+		},
+		Edges: []TopoEdge{{From: "u", To: "lb"}, {From: "lb", To: "svc"}},
+	})
+}
+
+// instanceCapacity is what one replica of size 1 of the service sustains.
+func instanceCapacity(t *testing.T) float64 {
+	t.Helper()
+	return nodeCapacity(mustGraph(t, Topology{Blocks: []TopoBlock{{ID: "svc", Kind: "service"}}}).Node("svc"), 1)
+}
+
+func runBalanced(t *testing.T, g *Graph, rps float64, ticks int) BlockResult {
+	t.Helper()
+	state := NewSimState(g)
+	var results []BlockResult
+	for range ticks {
+		var err error
+		if results, err = SimulateTick(g, rps, 1, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return results[2]
+}
+
+func TestLeastConnectionsBeatsRoundRobinOnUnequalReplicas(t *testing.T) {
+	// One double-size replica: 4 instances' worth of capacity at 70%.
+	sizes := []float64{2, 1, 1}
+	rps := 0.7 * 4 * instanceCapacity(t)
+	rr := runBalanced(t, balancedGraph(t, BalanceRoundRobin, sizes), rps, 50)
+	lc := runBalanced(t, balancedGraph(t, BalanceLeastConn, sizes), rps, 50)
+	if len(rr.Replicas) != 3 || rr.Replicas[0].Size != 2 {
+		t.Fatalf("each replica should be reported with its size, got %+v", rr.Replicas)
+	}
+	// Round-robin gives the small replicas a third each: 93% busy.
+	if rr.Health != "red" || rr.Replicas[1].Util < 0.9 || rr.Replicas[0].Util > 0.5 {
+		t.Errorf("round-robin should overload the small replicas, got %s with %+v", rr.Health, rr.Replicas)
+	}
+	if lc.Health != "yellow" || lc.Metrics["replica_imbalance"] > 1.01 {
+		t.Errorf("least-connections should load replicas by size, got %s with %+v", lc.Health, lc.Replicas)
+	}
+	if !(rr.Metrics["replica_imbalance"] > 1.2) {
+		t.Errorf("round-robin imbalance should show, got %g", rr.Metrics["replica_imbalance"])
+	}
+	if !(rr.Metrics["tail_latency_ms"] > lc.Metrics["tail_latency_ms"]) {
+		t.Errorf("the busy small replicas should raise the tail: rr %gms, lc %gms",
+			rr.Metrics["tail_latency_ms"], lc.Metrics["tail_latency_ms"])
+	}
+}
+
+func TestEvenBalancedReplicasMatchPooledBlock(t *testing.T) {
+	rps := 1.2 * 3 * instanceCapacity(t)
+	pooled := runBalanced(t, balancedGraph(t, "", nil), rps, 20)
+	for _, algo := range []string{BalanceRoundRobin, BalanceLeastConn, BalanceP2C} {
+		even := runBalanced(t, balancedGraph(t, algo, nil), rps, 20)
+		if math.Abs(pooled.RPS-even.RPS) > 1e-6 || math.Abs(pooled.QueueDepth-even.QueueDepth) > 1e-6 {
+			t.Errorf("%s: equal replicas should behave like the pooled block: %g/%g vs %g/%g",
+				algo, pooled.RPS, pooled.QueueDepth, even.RPS, even.QueueDepth)
+		}
+	}
+	if len(pooled.Replicas) != 0 {
+		t.Errorf("unbalanced replicas are pooled, got %d reported", len(pooled.Replicas))
+	}
+}
+
+func TestBalanceShares(t *testing.T) {
+	node := balancedGraph(t, BalanceConsistentHash, nil).Node("svc")
+	ring := ringShares(node, []int{0, 1, 2})
+	if sum := ring[0] + ring[1] + ring[2]; math.Abs(sum-1) > 1e-9 {
+		t.Errorf("the ring should cover the key space, shares sum to %g", sum)
+	}
+	for _, s := range ring {
+		if math.Abs(s-1.0/3) > 0.1 {
+			t.Errorf("100 vnodes should keep shares near a third, got %v", ring)
+		}
+	}
+
+	random := randomShares(node, []int{0, 1, 2}, 300, 7)
+	if again := randomShares(node, []int{0, 1, 2}, 300, 7); random[0] != again[0] {
+		t.Error("random shares should repeat for the same tick")
+	}
+	if math.Abs(random[0]+random[1]+random[2]-1) > 1e-9 || random[0] == 1.0/3 {
+		t.Errorf("random shares should be noisy and sum to 1, got %v", random)
+	}
+
+	// Two choices rarely pick the busiest replica and never pick it over both.
+	p2c := p2cShares([]float64{0, 0, 10}, []float64{1, 1, 1})
+	if !approx(p2c[0], 0.5) || !approx(p2c[2], 0) {
+		t.Errorf("p2c should route around the busy replica, got %v", p2c)
+	}
+	if even := p2cShares([]float64{1, 1, 1}, []float64{1, 1, 1}); !approx(even[0], 1.0/3) {
+		t.Errorf("p2c over equal loads should be even, got %v", even)
+	}
+}
+
+func TestStaticBalanceBottleneck(t *testing.T) {
+	sizes := []float64{2, 1, 1}
+	rps := 0.5 * 3 * instanceCapacity(t)
+	bottleneck := func(algo string) float64 {
+		results, err := Simulate(balancedGraph(t, algo, sizes), rps, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[2].Bottleneck
+	}
+	// Round-robin loads the small replicas like the pooled block; least
+	// connections spreads the load over 4 instances' worth.
+	rr, lc := bottleneck(BalanceRoundRobin), bottleneck(BalanceLeastConn)
+	if !approx(lc, rr*0.75) {
+		t.Errorf("least-connections should run at 3/4 of round-robin's peak, got %g vs %g", lc, rr)
+	}
+}
+
+func TestBalanceRejected(t *testing.T) {
+	for name, topo := range map[string]Topology{
+		"algorithm": {Blocks: []TopoBlock{{ID: "lb", Kind: "load_balancer", Balance: "fastest"}}},
+		"replicated": {
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Replicas: 3, Replication: &Replication{}}},
+			Edges:  []TopoEdge{{From: "u", To: "db", Balance: BalanceRandom}},
+		},
+	} {
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%s: BuildGraph should fail", name)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_balance" {
+			t.Errorf("%s: Validate should report bad_balance, got %+v", name, r.Errors)
+		}
+	}
+}
+
+func TestReplicaAndShardConfigRejected(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		block TopoBlock
+		code  string
+	}{
+		{"size", TopoBlock{ID: "db", Kind: "sql_datastore", Replicas: 2, ReplicaSizes: []float64{1, 0}}, "bad_replicas"},
+		{"replicated", TopoBlock{ID: "db", Kind: "sql_datastore", Replicas: 3, DownReplicas: 1, Replication: &Replication{}}, "bad_replicas"},
+		{"skewed", TopoBlock{ID: "db", Kind: "sql_datastore", Shards: 4, ReplicaSizes: []float64{1, 2}, ShardSkew: &ShardSkew{HotShare: 0.5}}, "bad_shards"},
+	} {
+		topo := Topology{Blocks: []TopoBlock{tc.block}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%s: BuildGraph should fail", tc.name)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != tc.code {
+			t.Errorf("%s: Validate should report %s, got %+v", tc.name, tc.code, r.Errors)
+		}
+	}
+}
+
+func TestNegativeReplicasAndShardsClampToOne(t *testing.T) {
+	// Saved topologies with a negative count load as a single instance.
+	topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Replicas: -1, Shards: -2}}}
+	g, err := BuildGraph(topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Node("db"); n.Replicas != 1 || n.Shards != 1 {
+		t.Errorf("want 1 replica and 1 shard, got %d and %d", n.Replicas, n.Shards)
+	}
+	if r := Validate(topo); !r.OK() {
+		t.Errorf("negative counts should validate, got %+v", r.Errors)
+	}
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// Cache eviction policies for CacheModel.Eviction.
+const (
+	EvictLRU = "lru"
+	EvictLFU = "lfu"
+	EvictTTL = "ttl"
+)
+
+const (
+	defaultObjectKB = 1
+	defaultZipfS    = 0.99
+	defaultTTLs     = 300
+
+	// maxZipfS bounds the skew: far past it, tail popularities underflow to
+	// zero and the model stops meaning anything.
+	maxZipfS = 10
+
+	// cacheUsableMem is the share of memory holding objects; the rest goes
+	// to overhead and eviction headroom, as in Redis's 80% eviction mark.
+	cacheUsableMem = 0.8
+
+	// zipfSingles ranks are modelled one by one; beyond them ranks are
+	// grouped into buckets growing by zipfBucketGrowth.
+	zipfSingles      = 64
+	zipfBucketGrowth = 1.05
+
+	// maxCheT caps the search for LRU's characteristic time, in requests.
+	maxCheT = 1e300
+)
+
+// CacheModel describes the working set a cache serves: KeySpace objects of
+// ObjectKB each, requested with Zipf skew ZipfS. The hit ratio then follows
+// from how many objects fit in the cache's memory under its eviction policy.
+// An unset ZipfS means 0.99; an explicit 0 is uniform access.
+type CacheModel struct {
+	KeySpace float64  `json:"key_space"`
+	ObjectKB float64  `json:"object_kb,omitempty"`
+	ZipfS    *float64 `json:"zipf_s,omitempty"`
+	Eviction string   `json:"eviction,omitempty"`
+	TTLs     float64  `json:"ttl_s,omitempty"` // entry lifetime under EvictTTL
+}
+
+func (m CacheModel) withDefaults() CacheModel {
+	if m.ObjectKB == 0 {
+		m.ObjectKB = defaultObjectKB
+	}
+	if m.ZipfS == nil {
+		s := defaultZipfS
+		m.ZipfS = &s
+	}
+	if m.Eviction == "" {
+		m.Eviction = EvictLRU
+	}
+	if m.TTLs == 0 {
+		m.TTLs = defaultTTLs
+	}
+	return m
+}
+
+func (m CacheModel) validate() error {
+	switch m.Eviction {
+	case "", EvictLRU, EvictLFU, EvictTTL:
+	default:
+		return fmt.Errorf("unknown eviction policy %q (want %s, %s or %s)", m.Eviction, EvictLRU, EvictLFU, EvictTTL)
+	}
+	if !(m.KeySpace >= 1) {
+		return fmt.Errorf("cache model key_space = %g, want at least 1", m.KeySpace)
+	}
+	if math.IsNaN(m.ObjectKB) || m.ObjectKB < 0 {
+		return fmt.Errorf("cache model object_kb = %g below 0", m.ObjectKB)
+	}
+	if m.ZipfS != nil && !(*m.ZipfS >= 0 && *m.ZipfS <= maxZipfS) {
+		return fmt.Errorf("cache model zipf_s = %g outside [0, %d]", *m.ZipfS, maxZipfS)
+	}
+	if math.IsNaN(m.TTLs) || m.TTLs < 0 {
+		return fmt.Errorf("cache model ttl_s = %g below 0", m.TTLs)
+	}
+	return nil
+}
+
+// cacheObjects is how many objects the node holds across its replicas and
+// shards.
+func cacheObjects(node *Node) float64 {
+	mb := float64(scaledProfile(node).MemoryMB*node.Shards) * cacheUsableMem
+	return mb * 1024 / node.CacheModel.ObjectKB
+}
+
+// modelHitRatio is the steady-state share of reads the node's cache model
+// serves at readRPS.
+func modelHitRatio(node *Node, readRPS float64) float64 {
+	m := node.CacheModel
+	return zipfHitRatio(node.zipf, cacheObjects(node), m.Eviction, m.TTLs*readRPS)
+}
+
+// zipfBucket is n keys of equal popularity p (probability per request).
+type zipfBucket struct{ n, p float64 }
+
+// zipfBuckets groups the ranks 1..keys of a Zipf(s) popularity law, most
+// popular first.
+func zipfBuckets(keys, s float64) []zipfBucket {
+	keys = math.Floor(keys)
+	var bs []zipfBucket
+	var total float64
+	for lo := 1.0; lo <= keys; {
+		hi := lo
+		if lo > zipfSingles {
+			hi = math.Min(keys, math.Floor(lo*zipfBucketGrowth))
+		}
+		// Mass of ranks lo..hi, approximated by the integral of x^-s.
+		var mass float64
+		if hi == lo {
+			mass = math.Pow(lo, -s)
+		} else if math.Abs(s-1) < 1e-9 {
+			mass = math.Log((hi + 0.5) / (lo - 0.5))
+		} else {
+			mass = (math.Pow(hi+0.5, 1-s) - math.Pow(lo-0.5, 1-s)) / (1 - s)
+		}
+		n := hi - lo + 1
+		bs = append(bs, zipfBucket{n, mass / n})
+		total += mass
+		lo = hi + 1
+	}
+	for i := range bs {
+		bs[i].p /= total
+	}
+	return bs
+}
+
+// zipfHitRatio is the hit ratio of a cache holding up to capacity objects.
+// LFU keeps the most popular keys; LRU follows Che's approximation, where a
+// key stays cached for a characteristic number of requests T; TTL keeps a
+// key for ttlRequests after each miss, and no longer than LRU would.
+func zipfHitRatio(bs []zipfBucket, capacity float64, eviction string, ttlRequests float64) float64 {
+	var keys float64
+	for _, b := range bs {
+		keys += b.n
+	}
+	if capacity >= keys {
+		if eviction != EvictTTL {
+			return 1
+		}
+		return ttlHitRatio(bs, ttlRequests)
+	}
+	if capacity <= 0 {
+		return 0
+	}
+	switch eviction {
+	case EvictLFU:
+		var hit, held float64
+		for _, b := range bs {
+			n := math.Min(b.n, capacity-held)
+			hit += n * b.p
+			if held += n; held >= capacity {
+				break
+			}
+		}
+		return hit
+	case EvictTTL:
+		return math.Min(ttlHitRatio(bs, ttlRequests), lruHitRatio(bs, capacity))
+	}
+	return lruHitRatio(bs, capacity)
+}
+
+// lruHitRatio solves sum(n*(1-exp(-p*T))) = capacity for Che's T by
+// bisection and returns the hit ratio at that T. Keys whose popularity
+// underflows to zero are never requested and never cached, so when the rest
+// all fit the search for T stops at maxCheT.
+func lruHitRatio(bs []zipfBucket, capacity float64) float64 {
+	occupied := func(t float64) float64 {
+		var c float64
+		for _, b := range bs {
+			if b.p > 0 {
+				c += b.n * -math.Expm1(-b.p*t)
+			}
+		}
+		return c
+	}
+	lo, hi := 0.0, 1.0
+	for occupied(hi) < capacity && hi < maxCheT {
+		hi *= 2
+	}
+	for i := 0; i < 64; i++ {
+		mid := (lo + hi) / 2
+		if occupied(mid) < capacity {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	var hit float64
+	for _, b := range bs {
+		if b.p > 0 {
+			hit += b.n * b.p * -math.Expm1(-b.p*hi)
+		}
+	}
+	return hit
+}
+
+// ttlHitRatio is the hit ratio when each miss caches the key for ttlRequests
+// requests: a key requested with probability p hits p*T/(1+p*T) of the time.
+func ttlHitRatio(bs []zipfBucket, ttlRequests float64) float64 {
+	var hit float64
+	for _, b := range bs {
+		x := b.p * ttlRequests
+		hit += b.n * b.p * x / (1 + x)
+	}
+	return hit
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func modelGraph(t *testing.T, memoryMB float64, model CacheModel) *Graph {
+	t.Helper()
+	redis := TopoBlock{ID: "r", Kind: "redis", CacheModel: &model, Overrides: map[string]float64{ParamMemoryMB: memoryMB}}
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, redis, {ID: "db", Kind: "sql_datastore"}},
+		Edges:  []TopoEdge{{From: "u", To: "r"}, {From: "r", To: "db"}},
+	})
+}
+
+// modelHit runs one read-only tick and returns the cache's hit ratio and the
+// reads that reach the store.
+func modelHit(t *testing.T, g *Graph) (float64, float64) {
+	t.Helper()
+	results, err := SimulateTick(g, 1000, 1, NewSimState(g))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results[1].Metrics["hit_ratio"], results[2].RPS
+}
+
+func TestCacheModelMemoryRaisesHitRatio(t *testing.T) {
+	// 10M keys of 1 KB: 1 GB holds about 8% of them.
+	model := CacheModel{KeySpace: 1e7}
+	small, smallDB := modelHit(t, modelGraph(t, 1024, model))
+	big, bigDB := modelHit(t, modelGraph(t, 4096, model))
+	if !(big > small) {
+		t.Errorf("4x memory should raise the hit ratio, got %g then %g", small, big)
+	}
+	if !(bigDB < smallDB) {
+		t.Errorf("a better hit ratio should spare the store, got %g then %g", smallDB, bigDB)
+	}
+	if !approx(smallDB, 1000*(1-small)) {
+		t.Errorf("store should see the misses, %g of 1000 at hit ratio %g", smallDB, small)
+	}
+}
+
+func TestCacheModelShardsAddCapacity(t *testing.T) {
+	model := CacheModel{KeySpace: 1e7}
+	one, _ := modelHit(t, modelGraph(t, 1024, model))
+	g := modelGraph(t, 1024, model)
+	g.Node("r").Shards = 4
+	four, _ := modelHit(t, g)
+	if !(four > one) {
+		t.Errorf("shards should hold more keys, hit ratio %g then %g", one, four)
+	}
+}
+
+func TestCacheModelSkew(t *testing.T) {
+	flatS, skewedS := 0.6, 1.2
+	flat, _ := modelHit(t, modelGraph(t, 1024, CacheModel{KeySpace: 1e7, ZipfS: &flatS}))
+	skewed, _ := modelHit(t, modelGraph(t, 1024, CacheModel{KeySpace: 1e7, ZipfS: &skewedS}))
+	if !(skewed > flat) {
+		t.Errorf("a skewed workload should hit more, got %g at s=0.6 and %g at s=1.2", flat, skewed)
+	}
+}
+
+func TestCacheModelEvictionPolicies(t *testing.T) {
+	bs := zipfBuckets(1e6, 0.9)
+	lru := zipfHitRatio(bs, 1e5, EvictLRU, 0)
+	lfu := zipfHitRatio(bs, 1e5, EvictLFU, 0)
+	if !(lfu > lru) {
+		t.Errorf("LFU keeps the hottest keys and should beat LRU: lfu %g, lru %g", lfu, lru)
+	}
+	if short := zipfHitRatio(bs, 1e5, EvictTTL, 1e3); !(short < lru) {
+		t.Errorf("a short TTL should expire keys LRU would keep: ttl %g, lru %g", short, lru)
+	}
+	if long := zipfHitRatio(bs, 1e5, EvictTTL, 1e12); !approx(long, lru) {
+		t.Errorf("a long TTL is bounded by memory like LRU: ttl %g, lru %g", long, lru)
+	}
+	if all := zipfHitRatio(bs, 2e6, EvictLRU, 0); all != 1 {
+		t.Errorf("a cache holding every key should always hit, got %g", all)
+	}
+}
+
+func TestCacheModelExtremeSkew(t *testing.T) {
+	// At s=10 rank 2 already takes under 0.1% of requests. Past it the tail
+	// underflows to zero popularity, and a cache with room for every key
+	// still requested must not send the LRU solve off to infinity.
+	for _, s := range []float64{maxZipfS, 50, 200} {
+		bs := zipfBuckets(1e9, s)
+		for _, capacity := range []float64{1e5, 1e8} {
+			for _, eviction := range []string{EvictLRU, EvictLFU} {
+				if hit := zipfHitRatio(bs, capacity, eviction, 0); math.IsNaN(hit) || !(hit > 0.99 && hit <= 1) {
+					t.Errorf("s=%g, %g objects, %s: hit ratio %g, want just under 1", s, capacity, eviction, hit)
+				}
+			}
+		}
+	}
+	s := float64(maxZipfS)
+	if hit, _ := modelHit(t, modelGraph(t, 1024, CacheModel{KeySpace: 1e9, ZipfS: &s})); math.IsNaN(hit) || hit < 0.99 {
+		t.Errorf("s=%g through the model: hit ratio %g", s, hit)
+	}
+}
+
+func TestCacheModelUniform(t *testing.T) {
+	var m CacheModel
+	if err := json.Unmarshal([]byte(`{"key_space": 1e7}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := *m.withDefaults().ZipfS; got != defaultZipfS {
+		t.Errorf("unset zipf_s should default to %g, got %g", defaultZipfS, got)
+	}
+	skewed, _ := modelHit(t, modelGraph(t, 1024, m))
+	if err := json.Unmarshal([]byte(`{"key_space": 1e7, "zipf_s": 0}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := *m.withDefaults().ZipfS; got != 0 {
+		t.Errorf("an explicit 0 should be kept, got %g", got)
+	}
+	// Uniform access over 10M keys hits in proportion to the share cached.
+	uniform, _ := modelHit(t, modelGraph(t, 1024, m))
+	if want := cacheUsableMem * 1024 * 1024 / 1e7; !(uniform < skewed) || math.Abs(uniform-want) > 0.01 {
+		t.Errorf("uniform hit ratio %g, want about %g and below skewed %g", uniform, want, skewed)
+	}
+}
+
+func TestZipfBucketsNormalised(t *testing.T) {
+	for _, s := range []float64{0, 0.99, 1, 1.5} {
+		var keys, mass float64
+		for _, b := range zipfBuckets(123456, s) {
+			keys += b.n
+			mass += b.n * b.p
+		}
+		if keys != 123456 || math.Abs(mass-1) > 1e-9 {
+			t.Errorf("s=%g: buckets cover %g keys with mass %g", s, keys, mass)
+		}
+	}
+}
+
+func TestHitRatioOverrideBeatsCacheModel(t *testing.T) {
+	g := modelGraph(t, 1024, CacheModel{KeySpace: 1e7})
+	g.Node("r").params[ParamHitRatio] = 0.5
+	if _, db := modelHit(t, g); !approx(db, 500) {
+		t.Errorf("hit_ratio override should win over the model, store sees %g", db)
+	}
+}
+
+func TestCacheModelValidation(t *testing.T) {
+	negative, steep := -1.0, maxZipfS+1.0
+	for _, m := range []CacheModel{{}, {KeySpace: 1e6, Eviction: "fifo"}, {KeySpace: 1e6, ZipfS: &negative}, {KeySpace: 1e6, ZipfS: &steep}} {
+		topo := Topology{Blocks: []TopoBlock{{ID: "r", Kind: "redis", CacheModel: &m}}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%+v: BuildGraph should fail", m)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_cache_model" {
+			t.Errorf("%+v: Validate should report bad_cache_model, got %+v", m, r.Errors)
+		}
+	}
+}
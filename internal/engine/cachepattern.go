@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+// Caching patterns, declared on the edge from a cache to its backing store.
+const (
+	// CacheAside: the application reads the cache, loads misses from the
+	// store and fills them back in; writes go straight to the store and only
+	// invalidate the cache.
+	CacheAside = "cache-aside"
+	// WriteThrough: writes update the cache and the store synchronously.
+	WriteThrough = "write-through"
+	// WriteBehind: writes are acknowledged by the cache and flushed to the
+	// store in batches every flush interval.
+	WriteBehind = "write-behind"
+)
+
+// Engine-owned BlockState.Extra keys for caching patterns.
+const (
+	stateFills            = "cache_fills"          // fill writes the cache owes itself next tick
+	stateStoreLatency     = "store_latency_ms"     // on backing stores: last tick's latency
+	stateWriteBehindSince = "write_behind_since_s" // on caches: time since the last flush
+	writeBehindPrefix     = "write_behind:"        // on caches: buffered writes per store
+)
+
+func writeBehindKey(to string) string { return writeBehindPrefix + to }
+
+func checkCachePattern(e TopoEdge) error {
+	switch e.Cache {
+	case "", CacheAside, WriteThrough, WriteBehind:
+	default:
+		return fmt.Errorf("unknown cache pattern %q (want cache-aside, write-through or write-behind)", e.Cache)
+	}
+	if e.Cache != "" && e.Async {
+		return fmt.Errorf("cache pattern %s cannot be async", e.Cache)
+	}
+	return nil
+}
+
+// cachePatterns reports whether node fronts a store through a caching
+// pattern, and whether any of them is cache-aside.
+func (n *Node) cachePatterns() (fronts, aside bool) {
+	for _, oe := range n.outgoing {
+		if oe.Cache != "" {
+			fronts = true
+			aside = aside || oe.Cache == CacheAside
+		}
+	}
+	return fronts, aside
+}
+
+// patternLatency is the latency a cache's patterns add to its average request:
+// read misses wait for the store under every pattern; writes wait for it under
+// cache-aside and write-through but not write-behind. missRatio is the share
+// of the cache's reads it did not serve.
+func patternLatency(state *SimState, node *Node, missRatio, readRatio float64) float64 {
+	var lat float64
+	for _, oe := range node.outgoing {
+		if oe.Cache == "" {
+			continue
+		}
+		store := oe.Weight * (state.Blocks[oe.To].Extra[stateStoreLatency] + oe.LatencyMs)
+		lat += readRatio * missRatio * store
+		if oe.Cache != WriteBehind {
+			lat += (1 - readRatio) * store
+		}
+	}
+	return lat
+}
+
+// flushWriteBehind hands a cache's buffered writes to their stores once per
+// flush interval, through the edge's load balancing like any other traffic.
+func flushWriteBehind(node *Node, bs *BlockState, p blocks.Profile, arriving map[string]flow, balancing map[string]map[string]flow, dt float64) {
+	interval := p.FlushIntervalMs
+	if interval <= 0 {
+		interval = blocks.DefaultFlushIntervalMs
+	}
+	since := bs.Extra[stateWriteBehindSince] + dt
+	if since+flushSlack >= interval/1000 {
+		since = 0
+		for _, oe := range node.outgoing {
+			if n := bs.Extra[writeBehindKey(oe.To)]; oe.Cache == WriteBehind && n > 0 {
+				arriving[oe.To] = flow{arriving[oe.To].reads, arriving[oe.To].writes + n}
+				addBalanced(balancing, oe, flow{0, n})
+				bs.Extra[writeBehindKey(oe.To)] = 0
+			}
+		}
+	}
+	bs.Extra[stateWriteBehindSince] = since
+}
+
+// dropWriteBehind discards a killed cache's buffered writes and returns how
+// many there were.
+func dropWriteBehind(bs *BlockState) float64 {
+	var n float64
+	for k, v := range bs.Extra {
+		if strings.HasPrefix(k, writeBehindPrefix) {
+			n += v
+			bs.Extra[k] = 0
+		}
+	}
+	return n
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+func cacheGraph(t *testing.T, pattern string, durability blocks.Durability) *Graph {
+	t.Helper()
+	// A small cache, so fills can warm it within a few seconds.
+	redis := TopoBlock{ID: "r", Kind: "redis", Durability: durability, Overrides: map[string]float64{ParamMemoryMB: 64}}
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, redis, {ID: "db", Kind: "sql_datastore"}},
+		Edges:  []TopoEdge{{From: "u", To: "r"}, {From: "r", To: "db", Cache: pattern, LatencyMs: 10}},
+	})
+}
+
+func TestCacheAsideFillsWarmCache(t *testing.T) {
+	dbRPS := func(pattern string) float64 {
+		g := cacheGraph(t, pattern, "")
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 300 {
+			results, _ = SimulateTick(g, 5000, 1, state)
+		}
+		return results[2].RPS
+	}
+	// Read-only traffic never writes to a plain cache, so it never warms.
+	if plain := dbRPS(""); plain < 4999 {
+		t.Errorf("plain cache should pass nearly every read, got %g", plain)
+	}
+	if aside := dbRPS(CacheAside); aside > 3000 {
+		t.Errorf("cache-aside fills should warm the cache, db still sees %g", aside)
+	}
+}
+
+func TestCacheAsideWritesBypassCache(t *testing.T) {
+	cacheRPS := func(pattern string) float64 {
+		g := cacheGraph(t, pattern, "")
+		results, _ := SimulateTick(g, 1000, 0, NewSimState(g))
+		if !approx(results[2].RPS, 1000) {
+			t.Errorf("%s: store should get every write, got %g", pattern, results[2].RPS)
+		}
+		return results[1].RPS
+	}
+	if aside := cacheRPS(CacheAside); aside != 0 {
+		t.Errorf("cache-aside writes should skip the cache, it handled %g", aside)
+	}
+	if through := cacheRPS(WriteThrough); !approx(through, 1000) {
+		t.Errorf("write-through writes should update the cache, it handled %g", through)
+	}
+}
+
+func TestCacheAsideBypassOnlyReachesStore(t *testing.T) {
+	// The cache also feeds a plain downstream edge, which must not pick up
+	// the writes that skipped the cache.
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "r", Kind: "redis"}, {ID: "db", Kind: "sql_datastore"}, {ID: "svc", Kind: "service"}},
+		Edges: []TopoEdge{
+			{From: "u", To: "r"},
+			{From: "r", To: "db", Cache: CacheAside},
+			{From: "r", To: "svc"},
+		},
+	})
+	check := func(model string, results []BlockResult) {
+		byID := map[string]BlockResult{}
+		for _, br := range results {
+			byID[br.ID] = br
+		}
+		if !approx(byID["db"].RPS, 1000) {
+			t.Errorf("%s: store should get every write, got %g", model, byID["db"].RPS)
+		}
+		if byID["svc"].RPS != 0 {
+			t.Errorf("%s: bypassed writes leaked onto the plain edge: %g", model, byID["svc"].RPS)
+		}
+	}
+	tick, _ := SimulateTick(g, 1000, 0, NewSimState(g))
+	check("tick", tick)
+	steady, _ := Simulate(g, 1000, 0)
+	check("steady state", steady)
+}
+
+func TestCachePatternWriteLatency(t *testing.T) {
+	latency := func(pattern string) (float64, float64) {
+		g := cacheGraph(t, pattern, "")
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 2 {
+			results, _ = SimulateTick(g, 1000, 0, state)
+		}
+		return results[1].Latency, results[2].PathLatency
+	}
+	through, dbPath := latency(WriteThrough)
+	behind, _ := latency(WriteBehind)
+	// Write-through writes wait for the store: 10ms away, plus its fsync.
+	if !approx(through-behind, 10.5) {
+		t.Errorf("write-through should wait for the store: through %g, behind %g", through, behind)
+	}
+	if dbPath != 0.5 {
+		t.Errorf("the store's path should not restart from the cache, got %g", dbPath)
+	}
+}
+
+func TestWriteBehindBatchesWrites(t *testing.T) {
+	g := cacheGraph(t, WriteBehind, "")
+	state := NewSimState(g)
+	for tick := 1; tick <= 10; tick++ {
+		results, _ := SimulateTick(g, 1000, 0, state)
+		db := results[2]
+		arrived := db.RPS*state.Dt + db.QueueDepth
+		switch {
+		case tick < 10 && arrived != 0:
+			t.Errorf("tick %d: store should wait for the flush, got %g", tick, arrived)
+		case tick == 10 && !approx(arrived, 1000):
+			t.Errorf("flush should deliver the second's 1000 writes, got %g", arrived)
+		}
+	}
+}
+
+func TestWriteBehindFlushIsBalanced(t *testing.T) {
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "r", Kind: "redis"},
+			{ID: "db", Kind: "sql_datastore", Replicas: 3, ReplicaSizes: []float64{2, 1, 1}},
+		},
+		Edges: []TopoEdge{{From: "u", To: "r"}, {From: "r", To: "db", Cache: WriteBehind, Balance: BalanceLeastConn}},
+	})
+	state := NewSimState(g)
+	var results []BlockResult
+	for range 10 {
+		results, _ = SimulateTick(g, 200, 0, state)
+	}
+	// Least-connections loads the double-size replica twice as hard.
+	rs := results[2].Replicas
+	if len(rs) != 3 || rs[0].Util == 0 || !approx(rs[0].Util, rs[1].Util) {
+		t.Errorf("the flush should be balanced by size, got %+v", rs)
+	}
+}
+
+func TestWriteBehindBufferLostOnKill(t *testing.T) {
+	lost := func(d blocks.Durability) float64 {
+		g := cacheGraph(t, WriteBehind, d)
+		state := NewSimState(g)
+		for range 5 {
+			SimulateTick(g, 1000, 0, state)
+		}
+		g.Node("r").Dead = true
+		results, _ := SimulateTick(g, 1000, 0, state)
+		return results[1].LostWrites
+	}
+	// Even a per-write durable cache loses what it had not yet handed on.
+	if got := lost(blocks.DurabilityPerWrite); !approx(got, 500) {
+		t.Errorf("buffered writes should be lost, got %g", got)
+	}
+	// A none-durable cache counts them once, among all its writes.
+	if got := lost(""); !approx(got, 500) {
+		t.Errorf("buffered writes should not be counted twice, got %g", got)
+	}
+}
+
+func TestWriteBehindBufferDroppedWithItsEdge(t *testing.T) {
+	g := cacheGraph(t, WriteBehind, "")
+	state := NewSimState(g)
+	for range 5 {
+		SimulateTick(g, 1000, 0, state)
+	}
+	if state.AllDrained(g) {
+		t.Fatal("buffered writes should keep the state from draining")
+	}
+	// Turned into a plain edge, nothing would ever flush the buffer.
+	plain := cacheGraph(t, "", "")
+	pruneBacklogs(plain, state)
+	if n, ok := state.Blocks["r"].Extra[writeBehindKey("db")]; ok || !state.AllDrained(plain) {
+		t.Errorf("the buffer should go with its write-behind edge, %g left", n)
+	}
+}
+
+func TestSteadyStateMatchesTickCacheLoad(t *testing.T) {
+	// With the hit ratio pinned, both models should put the same load on
+	// the cache and its store.
+	for _, pattern := range []string{CacheAside, WriteThrough, WriteBehind} {
+		g := cacheGraph(t, pattern, "")
+		g.Node("r").params[ParamHitRatio] = 0.8
+		steady, err := Simulate(g, 1000, 0.8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := NewSimState(g)
+		var tick []BlockResult
+		window := make([]float64, 3)
+		for i := range 100 {
+			tick, _ = SimulateTick(g, 1000, 0.8, state)
+			if i >= 50 {
+				for j, br := range tick {
+					window[j] += br.RPS / 50
+				}
+			}
+		}
+		for j := 1; j < 3; j++ {
+			if math.Abs(window[j]-steady[j].RPS) > 0.01*steady[j].RPS {
+				t.Errorf("%s %s: steady state %g rps, tick mode %g", pattern, steady[j].ID, steady[j].RPS, window[j])
+			}
+		}
+	}
+}
+
+func TestCachePatternValidated(t *testing.T) {
+	for _, e := range []TopoEdge{{From: "r", To: "db", Cache: "refresh-ahead"}, {From: "r", To: "db", Cache: WriteBehind, Async: true}} {
+		topo := Topology{Blocks: []TopoBlock{{ID: "r", Kind: "redis"}, {ID: "db", Kind: "sql_datastore"}}, Edges: []TopoEdge{e}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%+v: BuildGraph should fail", e)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_cache_pattern" {
+			t.Errorf("%+v: Validate should report bad_cache_pattern, got %+v", e, r.Errors)
+		}
+	}
+}
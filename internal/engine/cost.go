@@ -0,0 +1,43 @@
+package engine
+
+import "github.com/prashanth/archimedes/internal/instances"
+
+const hoursPerMonth = 730
+
+type BlockCost struct {
+	ID        string  `json:"id"`
+	Instance  string  `json:"instance"`
+	Replicas  int     `json:"replicas"`
+	HourlyUSD float64 `json:"hourly_usd"`
+}
+
+// CostReport prices the blocks that name an instance type. Blocks without one
+// are managed services or unpriced and are listed in Unpriced.
+type CostReport struct {
+	Blocks     []BlockCost `json:"blocks"`
+	Unpriced   []string    `json:"unpriced"`
+	HourlyUSD  float64     `json:"hourly_usd"`
+	MonthlyUSD float64     `json:"monthly_usd"`
+}
+
+// Cost estimates on-demand compute spend: each priced block costs its
+// instance's hourly rate times its replicas.
+func Cost(g *Graph) CostReport {
+	r := CostReport{Blocks: []BlockCost{}, Unpriced: []string{}}
+	for _, id := range g.ids {
+		n := g.nodes[id]
+		if n.Kind == "user" {
+			continue
+		}
+		t, ok := instances.Get(n.Instance)
+		if !ok {
+			r.Unpriced = append(r.Unpriced, id)
+			continue
+		}
+		bc := BlockCost{ID: id, Instance: t.Name, Replicas: n.Replicas, HourlyUSD: t.HourlyUSD * float64(n.Replicas)}
+		r.Blocks = append(r.Blocks, bc)
+		r.HourlyUSD += bc.HourlyUSD
+	}
+	r.MonthlyUSD = r.HourlyUSD * hoursPerMonth
+	return r
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+// Disk media a node can choose for its storage.
+const (
+	DiskNVMe    = "nvme"    // local NVMe SSD
+	DiskHDD     = "hdd"     // spinning disk: fine for sequential logs, slow for random IO
+	DiskNetwork = "network" // network volume with baseline IOPS and a burst bucket
+)
+
+// Defaults for a network volume, after a 100GB general-purpose volume:
+// 3 IOPS/GB baseline, bursting to 3000 IOPS from a 5.4M credit bucket.
+const (
+	defaultBaselineIOPS = 300
+	defaultBurstIOPS    = 3000
+	defaultBurstCredits = 5.4e6
+
+	stateBurstCredits = "disk_burst_credits" // engine-owned key in BlockState.Extra
+)
+
+// DiskSpec selects a node's storage media. Burst fields apply to network
+// volumes only: each volume earns BaselineIOPS credits per second, spends one
+// per IO, and can run at BurstIOPS while its bucket has credits.
+type DiskSpec struct {
+	Media        string  `json:"media"`
+	BaselineIOPS int     `json:"baseline_iops,omitempty"`
+	BurstIOPS    int     `json:"burst_iops,omitempty"`
+	BurstCredits float64 `json:"burst_credits,omitempty"` // IO credits in a full bucket
+}
+
+func (d DiskSpec) withDefaults() DiskSpec {
+	if d.Media != DiskNetwork {
+		return d
+	}
+	if d.BaselineIOPS <= 0 {
+		d.BaselineIOPS = defaultBaselineIOPS
+	}
+	if d.BurstIOPS <= 0 {
+		d.BurstIOPS = max(defaultBurstIOPS, d.BaselineIOPS)
+	}
+	if d.BurstCredits <= 0 {
+		d.BurstCredits = defaultBurstCredits
+	}
+	return d
+}
+
+func (d DiskSpec) validate() error {
+	switch d.Media {
+	case DiskNVMe, DiskHDD:
+	case DiskNetwork:
+		if d.BaselineIOPS < 0 || d.BurstIOPS < 0 || d.BurstCredits < 0 {
+			return fmt.Errorf("disk: negative network volume setting")
+		}
+		if d.BurstIOPS > 0 && d.BurstIOPS < d.BaselineIOPS {
+			return fmt.Errorf("disk: burst IOPS %d below baseline %d", d.BurstIOPS, d.BaselineIOPS)
+		}
+	default:
+		return fmt.Errorf("disk: unknown media %q (want nvme, hdd or network)", d.Media)
+	}
+	return nil
+}
+
+// iops is the sustained IOPS of one volume; network volumes sustain only
+// their baseline once the burst bucket is empty.
+func (d DiskSpec) iops() int {
+	switch d.Media {
+	case DiskHDD:
+		return blocks.HDDDiskIOPS
+	case DiskNetwork:
+		return d.BaselineIOPS
+	default:
+		return blocks.SSDDiskIOPS
+	}
+}
+
+// bursts reports whether the node's disk runs from a burst bucket. A
+// disk_iops override pins the IOPS and disables bursting.
+func (n *Node) bursts() bool {
+	_, pinned := n.params[ParamDiskIOPS]
+	return n.Disk != nil && n.Disk.Media == DiskNetwork && !pinned
+}
+
+// volumes is how many disks a node's scaled profile spans.
+func (n *Node) volumes() float64 { return float64(n.Replicas * n.Shards) }
+
+// applyBurst raises p's disk IOPS toward the burst rate, as far as the
+// credits in the node's bucket can pay for over a tick of dt seconds. p must
+// be the node's scaled profile.
+func applyBurst(node *Node, bs *BlockState, p *blocks.Profile, dt float64) {
+	vols := node.volumes()
+	burst := float64(node.Disk.BurstIOPS) * vols
+	funded := float64(node.Disk.BaselineIOPS)*vols + bs.Extra[stateBurstCredits]/dt
+	p.DiskIOPS = int(math.Min(burst, funded))
+}
+
+// spendBurst settles one tick of disk IO against the bucket: IO above the
+// baseline spends credits, IO below it earns them back. It returns the
+// bucket's fill fraction.
+func spendBurst(node *Node, bs *BlockState, p blocks.Profile, rps, readRatio, dt float64) float64 {
+	vols := node.volumes()
+	full := node.Disk.BurstCredits * vols
+	ioRate := rps * diskIOsPerRequest(p, readRatio)
+	credits := bs.Extra[stateBurstCredits] + (float64(node.Disk.BaselineIOPS)*vols-ioRate)*dt
+	credits = math.Max(0, math.Min(credits, full))
+	bs.Extra[stateBurstCredits] = credits
+	return credits / full
+}
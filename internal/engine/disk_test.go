@@ -0,0 +1,87 @@
+package engine
+
+import "testing"
+
+func TestDiskMediaCapacity(t *testing.T) {
+	capOf := func(disk *DiskSpec) float64 {
+		g, err := BuildGraph(Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Disk: disk}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodeCapacity(g.Node("db"), 0.3)
+	}
+	nvme := capOf(&DiskSpec{Media: DiskNVMe})
+	if def := capOf(nil); nvme != def {
+		t.Errorf("nvme should match the default SSD: %g vs %g", nvme, def)
+	}
+	hdd := capOf(&DiskSpec{Media: DiskHDD})
+	if hdd >= nvme/10 {
+		t.Errorf("hdd should be far slower than nvme: %g vs %g", hdd, nvme)
+	}
+	// The static model plans for the sustained baseline, not the burst.
+	if net := capOf(&DiskSpec{Media: DiskNetwork, BaselineIOPS: 3000}); net >= nvme || net <= hdd {
+		t.Errorf("3000 IOPS network volume should sit between hdd and nvme: %g", net)
+	}
+}
+
+func TestDiskBurstCreditsCollapse(t *testing.T) {
+	disk := &DiskSpec{Media: DiskNetwork, BaselineIOPS: 300, BurstIOPS: 3000, BurstCredits: 20000}
+	g, err := BuildGraph(Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Disk: disk}},
+		Edges:  []TopoEdge{{From: "u", To: "db"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseCap := nodeCapacity(g.Node("db"), 0.7)
+	rps := baseCap * 4 // well under the burst rate, far over the baseline
+
+	state := NewSimState(g)
+	results, _ := SimulateTick(g, rps, 0.7, state)
+	first := results[1]
+	if first.Dropped > 0 || first.QueueDepth > 0 {
+		t.Fatalf("burst should absorb %g RPS at first: %+v", rps, first)
+	}
+	if first.Metrics["burst_balance"] >= 1 || first.Metrics["disk_iops_limit"] != 3000 {
+		t.Errorf("first tick should spend credits at the burst limit: %v", first.Metrics)
+	}
+
+	var last BlockResult
+	for range 300 {
+		results, _ = SimulateTick(g, rps, 0.7, state)
+		last = results[1]
+	}
+	if last.Metrics["burst_balance"] > 0.01 || last.Metrics["disk_iops_limit"] > 1000 {
+		t.Errorf("credits should be exhausted: %v", last.Metrics)
+	}
+	if last.QueueDepth < 1000 || last.RPS > baseCap*1.5 {
+		t.Errorf("throughput should collapse toward the baseline once credits run out: %+v", last)
+	}
+}
+
+func TestDiskBurstRefills(t *testing.T) {
+	disk := &DiskSpec{Media: DiskNetwork, BurstCredits: 1000}
+	g, _ := BuildGraph(Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Disk: disk}},
+		Edges:  []TopoEdge{{From: "u", To: "db"}},
+	})
+	state := NewSimState(g)
+	state.Blocks["db"].Extra[stateBurstCredits] = 0
+	results, _ := SimulateTick(g, 0, 0, state)
+	// An idle 300 IOPS volume earns 30 credits per 100ms tick.
+	if got := results[1].Metrics["burst_balance"]; got < 0.029 || got > 0.031 {
+		t.Errorf("idle volume should earn baseline credits, balance %g", got)
+	}
+}
+
+func TestDiskRejected(t *testing.T) {
+	for _, d := range []DiskSpec{{Media: "tape"}, {Media: DiskNetwork, BaselineIOPS: 3000, BurstIOPS: 100}} {
+		topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Disk: &d}}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%+v: BuildGraph should fail", d)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_disk" {
+			t.Errorf("%+v: Validate should report bad_disk, got %+v", d, r.Errors)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+// Engine-owned BlockState.Extra keys for acknowledged writes not yet on disk.
+const (
+	stateUnflushed  = "unflushed_writes"
+	stateSinceFlush = "since_flush_s"
+	stateLostWrites = "lost_writes"
+)
+
+// flushSlack absorbs rounding when ticks add up to a flush interval.
+const flushSlack = 1e-9
+
+// fsyncMs is how long one fsync takes on the node's disk media.
+func fsyncMs(node *Node) float64 {
+	if node.Disk == nil {
+		return 0.5
+	}
+	switch node.Disk.Media {
+	case DiskHDD:
+		return 8
+	case DiskNetwork:
+		return 2
+	default:
+		return 0.5
+	}
+}
+
+func checkDurability(d blocks.Durability) error {
+	switch d {
+	case "", blocks.DurabilityNone, blocks.DurabilityBatch, blocks.DurabilityPerWrite:
+		return nil
+	}
+	return fmt.Errorf("unknown durability %q (want none, batch or per-write)", d)
+}
+
+// flushInterval is the seconds between a batch-durable block's group commits.
+func flushInterval(p blocks.Profile) float64 {
+	if p.FlushIntervalMs <= 0 {
+		return blocks.DefaultFlushIntervalMs / 1000.0
+	}
+	return p.FlushIntervalMs / 1000
+}
+
+// fsyncIOs is the disk IOs a write spends on durability: one fsync each under
+// per-write durability. Batch flushes are shared by every write in the window;
+// see flushIOPS.
+func fsyncIOs(p blocks.Profile) float64 {
+	if p.Durability == blocks.DurabilityPerWrite {
+		return 1
+	}
+	return 0
+}
+
+// flushIOPS is the disk IOPS one instance of a batch-durable block spends on
+// group commits, one fsync per flush interval, whatever the write rate.
+func flushIOPS(p blocks.Profile) float64 {
+	if p.Durability == blocks.DurabilityBatch {
+		return 1 / flushInterval(p)
+	}
+	return 0
+}
+
+// writeLatency is the latency durability adds to a write. Per-write blocks
+// wait for the fsync before acknowledging. Batch blocks acknowledge at once,
+// but a write that lands while a group commit holds the log waits out the
+// rest of it: on average half an fsync, for the share of time spent flushing.
+func writeLatency(node *Node, p blocks.Profile) float64 {
+	switch p.Durability {
+	case blocks.DurabilityPerWrite:
+		return fsyncMs(node)
+	case blocks.DurabilityBatch:
+		f := fsyncMs(node)
+		return min(f/(flushInterval(p)*1000), 1) * f / 2
+	}
+	return 0
+}
+
+// trackUnflushed records a tick of acknowledged writes and returns how many
+// would be lost if the block died now. None-durable blocks never flush; batch
+// blocks flush every FlushIntervalMs.
+func trackUnflushed(bs *BlockState, p blocks.Profile, writes, dt float64) float64 {
+	switch p.Durability {
+	case blocks.DurabilityNone:
+		bs.Extra[stateUnflushed] += writes
+	case blocks.DurabilityBatch:
+		interval := flushInterval(p)
+		since := bs.Extra[stateSinceFlush] + dt
+		bs.Extra[stateUnflushed] += writes
+		if since+flushSlack >= interval {
+			// Writes acknowledged after the last flush point stay
+			// unflushed; a tick may span several flushes.
+			since = max(0, math.Mod(since+flushSlack, interval)-flushSlack)
+			bs.Extra[stateUnflushed] = writes * min(since/dt, 1)
+		}
+		bs.Extra[stateSinceFlush] = since
+	default:
+		return 0
+	}
+	return bs.Extra[stateUnflushed]
+}
+
+// loseUnflushed moves a killed block's unflushed writes into its lost counter.
+func loseUnflushed(bs *BlockState) {
+	if n := bs.Extra[stateUnflushed]; n > 0 {
+		bs.Extra[stateLostWrites] += n
+		bs.Extra[stateUnflushed] = 0
+		bs.Extra[stateSinceFlush] = 0
+	}
+}
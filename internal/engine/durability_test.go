@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+func TestDurabilityThroughput(t *testing.T) {
+	capOf := func(d blocks.Durability) float64 {
+		g, err := BuildGraph(Topology{Blocks: []TopoBlock{{
+			ID: "db", Kind: "sql_datastore", Durability: d,
+			Overrides: map[string]float64{ParamDiskIOPS: 3000},
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodeCapacity(g.Node("db"), 0)
+	}
+	perWrite, batch := capOf(""), capOf(blocks.DurabilityBatch)
+	// 3000 IOPS over 5 page writes, plus a sixth for the fsync; batch spends
+	// one IOPS on its once-a-second group commit instead.
+	if !approx(perWrite, 500) || !approx(batch, 599.8) {
+		t.Errorf("group commit should save the per-write fsync: per-write %g, batch %g", perWrite, batch)
+	}
+}
+
+func TestDurabilityWriteLatency(t *testing.T) {
+	latency := func(d blocks.Durability, disk *DiskSpec) float64 {
+		g, _ := BuildGraph(Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Durability: d, Disk: disk}},
+			Edges:  []TopoEdge{{From: "u", To: "db"}},
+		})
+		results, _ := SimulateTick(g, 100, 0.5, NewSimState(g))
+		return results[1].Latency
+	}
+	batch := latency(blocks.DurabilityBatch, nil)
+	nvme := latency(blocks.DurabilityPerWrite, nil)
+	hdd := latency(blocks.DurabilityPerWrite, &DiskSpec{Media: DiskHDD})
+	// Half the requests are writes: 0.5 * 0.5ms on NVMe, 0.5 * 8ms on HDD.
+	if !approx(nvme-batch, 0.25) || !approx(hdd-batch, 4) {
+		t.Errorf("per-write fsync latency: batch %g, nvme %g, hdd %g", batch, nvme, hdd)
+	}
+}
+
+func TestDurabilityModesDiffer(t *testing.T) {
+	// An HDD's 8ms fsync against a 10ms flush interval: group commits hold
+	// the log 80% of the time and take 100 of the disk's IOPS.
+	run := func(d blocks.Durability) (capacity, latency float64) {
+		g, err := BuildGraph(Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {
+				ID: "db", Kind: "sql_datastore", Durability: d, Disk: &DiskSpec{Media: DiskHDD},
+				Overrides: map[string]float64{ParamDiskIOPS: 3000, ParamFlushIntervalMs: 10},
+			}},
+			Edges: []TopoEdge{{From: "u", To: "db"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, _ := SimulateTick(g, 100, 0, NewSimState(g))
+		return nodeCapacity(g.Node("db"), 0), results[1].Latency
+	}
+	noneCap, noneLat := run(blocks.DurabilityNone)
+	batchCap, batchLat := run(blocks.DurabilityBatch)
+	perCap, perLat := run(blocks.DurabilityPerWrite)
+	if !approx(noneCap, 600) || !approx(batchCap, 580) || !approx(perCap, 500) {
+		t.Errorf("capacity: none %g, batch %g, per-write %g", noneCap, batchCap, perCap)
+	}
+	// Batch writes wait 0.8 * 4ms on average; per-write ones the full 8ms.
+	if !approx(batchLat-noneLat, 3.2) || !approx(perLat-noneLat, 8) {
+		t.Errorf("latency: none %g, batch %g, per-write %g", noneLat, batchLat, perLat)
+	}
+}
+
+func TestKilledBlockLosesUnflushedWrites(t *testing.T) {
+	g, _ := BuildGraph(Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "k", Kind: "kafka"},
+			{ID: "r", Kind: "redis"},
+			{ID: "db", Kind: "sql_datastore"},
+		},
+		Edges: []TopoEdge{{From: "u", To: "k"}, {From: "u", To: "r"}, {From: "u", To: "db"}},
+	})
+	state := NewSimState(g)
+	for range 25 {
+		SimulateTick(g, 1000, 0.5, state)
+	}
+	for _, id := range []string{"k", "r", "db"} {
+		g.Node(id).Dead = true
+	}
+	results, _ := SimulateTick(g, 1000, 0.5, state)
+	lost := map[string]float64{}
+	for _, br := range results {
+		lost[br.ID] = br.LostWrites
+	}
+
+	// Each block takes 500 writes/s. Kafka flushes every second: 2.5s in,
+	// the last 0.5s are unflushed.
+	if !approx(lost["k"], 250) {
+		t.Errorf("kafka should lose its unflushed batch, lost %g", lost["k"])
+	}
+	// Redis keeps everything in memory: all 2.5s of writes.
+	if !approx(lost["r"], 1250) {
+		t.Errorf("redis should lose every acknowledged write, lost %g", lost["r"])
+	}
+	if lost["db"] != 0 {
+		t.Errorf("per-write SQL should lose nothing, lost %g", lost["db"])
+	}
+
+	// The counter stays after the block is revived.
+	g.Node("k").Dead = false
+	results, _ = SimulateTick(g, 1000, 0.5, state)
+	if results[1].LostWrites != lost["k"] {
+		t.Errorf("lost counter should persist, got %g", results[1].LostWrites)
+	}
+}
+
+func TestUnflushedWithTicksLongerThanFlushes(t *testing.T) {
+	// 2.5s ticks against a 1s flush: each tick flushes twice and leaves
+	// the writes of its last 0.5s unflushed.
+	bs := &BlockState{Extra: map[string]float64{}}
+	p := blocks.Profile{Durability: blocks.DurabilityBatch, FlushIntervalMs: 1000}
+	for tick := range 10 {
+		got := trackUnflushed(bs, p, 100, 2.5)
+		want := 20.0
+		if tick%2 == 1 {
+			want = 0 // 0.5s carried over plus 2.5s lands on a flush
+		}
+		if !approx(got, want) || bs.Extra[stateSinceFlush] >= 1 {
+			t.Fatalf("tick %d: want %g unflushed, got %g after %gs", tick, want, got, bs.Extra[stateSinceFlush])
+		}
+	}
+}
+
+func TestDurabilityRejected(t *testing.T) {
+	topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Durability: "sometimes"}}}
+	if _, err := BuildGraph(topo); err == nil {
+		t.Error("BuildGraph should reject unknown durability")
+	}
+	if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_durability" {
+		t.Errorf("Validate should report bad_durability, got %+v", r.Errors)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import "fmt"
+
+// Edge op filters. An edge without one carries both reads and writes.
+const (
+	OpsReads  = "reads"
+	OpsWrites = "writes"
+)
+
+// stateQueueReads is the engine-owned BlockState.Extra key holding how many
+// of the queued requests are reads; the rest of Queue is writes.
+const stateQueueReads = "queue_reads"
+
+// flow is traffic split by operation: requests per tick in SimulateTick,
+// per second in Simulate.
+type flow struct{ reads, writes float64 }
+
+func (f flow) total() float64 { return f.reads + f.writes }
+
+// readRatio is the share of reads in f, or fallback when f is empty.
+func (f flow) readRatio(fallback float64) float64 {
+	if t := f.total(); t > 0 {
+		return f.reads / t
+	}
+	return fallback
+}
+
+// scale returns f with both operations multiplied by k.
+func (f flow) scale(k float64) flow { return flow{f.reads * k, f.writes * k} }
+
+// along returns the part of f an edge carries.
+func (f flow) along(oe OutEdge) flow {
+	f = f.scale(oe.Weight * oe.Multiplier)
+	switch oe.Ops {
+	case OpsReads:
+		f.writes = 0
+	case OpsWrites:
+		f.reads = 0
+	}
+	return f
+}
+
+// absorb removes the reads a cache serves itself. ratio is a fraction of all
+// requests, as in blocks.TickEffect.AbsorbRatio; writes always pass through.
+func (f flow) absorb(ratio float64) flow {
+	f.reads = max(0, f.reads-ratio*f.total())
+	return f
+}
+
+func checkOps(ops string) error {
+	switch ops {
+	case "", OpsReads, OpsWrites:
+		return nil
+	}
+	return fmt.Errorf("unknown ops %q (want reads or writes)", ops)
+}
+
+// idleReadRatio is the mix assumed for a block that receives nothing: its
+// profile's natural mix if it has one, otherwise the global mix.
+func idleReadRatio(p float64, global float64) float64 {
+	if p > 0 {
+		return p
+	}
+	return global
+}
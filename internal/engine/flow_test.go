@@ -0,0 +1,85 @@
+package engine
+
+import "testing"
+
+func TestEdgeOpsSplitReadsAndWrites(t *testing.T) {
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service"}, {ID: "r", Kind: "redis"}, {ID: "k", Kind: "kafka"}},
+		Edges: []TopoEdge{
+			{From: "u", To: "s"},
+			{From: "s", To: "r", Ops: OpsReads},
+			{From: "s", To: "k", Ops: OpsWrites},
+		},
+	})
+	static, _ := Simulate(g, 1000, 0.8)
+	tick, _ := SimulateTick(g, 1000, 0.8, NewSimState(g))
+	for _, results := range [][]BlockResult{static, tick} {
+		if !approx(results[2].RPS, 800) || !approx(results[3].RPS, 200) {
+			t.Errorf("redis should get the 800 reads and kafka the 200 writes: %g, %g", results[2].RPS, results[3].RPS)
+		}
+	}
+	// Kafka sees only writes, so its durability window holds all of them.
+	if got := tick[3].Metrics["unflushed_writes"]; !approx(got, 20) {
+		t.Errorf("kafka should have one tick of writes unflushed, got %g", got)
+	}
+}
+
+func TestCacheAbsorbsOnlyReads(t *testing.T) {
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "r", Kind: "redis", Overrides: map[string]float64{ParamHitRatio: 0.9}},
+			{ID: "db", Kind: "sql_datastore"},
+		},
+		Edges: []TopoEdge{{From: "u", To: "r"}, {From: "r", To: "db"}},
+	})
+	// 800 reads and 200 writes reach Redis; 80 read misses and every write
+	// reach SQL, which now runs a write-heavy mix.
+	wantCPU := (80*0.5 + 200*1.0) / 8000
+	static, _ := Simulate(g, 1000, 0.8)
+	tick, _ := SimulateTick(g, 1000, 0.8, NewSimState(g))
+	for _, results := range [][]BlockResult{static, tick} {
+		db := results[2]
+		if !approx(db.RPS, 280) || !approx(db.CPUUtil, wantCPU) {
+			t.Errorf("sql should see 80 reads and 200 writes: rps %g, cpu %g (want %g)", db.RPS, db.CPUUtil, wantCPU)
+		}
+	}
+}
+
+func TestQueueKeepsMix(t *testing.T) {
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore"}},
+		Edges:  []TopoEdge{{From: "u", To: "db"}},
+	})
+	state := NewSimState(g)
+	SimulateTick(g, 50000, 0.2, state)
+	bs := state.Blocks["db"]
+	if bs.Queue == 0 || !approx(bs.Extra[stateQueueReads]/bs.Queue, 0.2) {
+		t.Errorf("queue should hold the arriving 20%% reads: %g of %g", bs.Extra[stateQueueReads], bs.Queue)
+	}
+}
+
+func TestEdgeOpsValidated(t *testing.T) {
+	topo := Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service"}},
+		Edges:  []TopoEdge{{From: "u", To: "s", Ops: "deletes"}},
+	}
+	if _, err := BuildGraph(topo); err == nil {
+		t.Error("BuildGraph should reject unknown ops")
+	}
+	if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_ops" {
+		t.Errorf("Validate should report bad_ops, got %+v", r.Errors)
+	}
+
+	// A user sending reads to one service and writes to another splits both
+	// fully.
+	split := Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "r", Kind: "service"}, {ID: "w", Kind: "service"}},
+		Edges:  []TopoEdge{{From: "u", To: "r", Ops: OpsReads}, {From: "u", To: "w", Ops: OpsWrites}},
+	}
+	for _, w := range Validate(split).Warnings {
+		if w.Code == "weight_sum" {
+			t.Errorf("per-op split should not warn: %+v", w)
+		}
+	}
+}
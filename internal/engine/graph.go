@@ -3,6 +3,9 @@ package engine
 import (
 	"errors"
 	"fmt"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+	"github.com/prashanth/archimedes/internal/instances"
 )
 
 type OutEdge struct {
@@ -10,21 +13,40 @@ type OutEdge struct {
 	Weight     float64
 	Multiplier float64
 	LatencyMs  float64
+	Async      bool   // queued on the source for the target to pull; see SimulateTick
+	Ops        string // OpsReads or OpsWrites to carry only those; "" carries both
+	Cache      string // caching pattern from a cache to its backing store, if any
+	Balance    string // algorithm spreading the traffic over the target's replicas, if any
 }
 
 type Node struct {
-	ID       string
-	Kind     string
-	Name     string
-	Dead     bool
-	Replicas int
-	Shards   int
-	CPUCores int
-	outgoing []OutEdge
+	ID           string
+	Kind         string
+	Name         string
+	Dead         bool
+	Replicas     int
+	Shards       int
+	CPUCores     int
+	Instance     string
+	Disk         *DiskSpec          // nil keeps the block's default disk
+	Durability   blocks.Durability  // "" keeps the block's default policy
+	CacheModel   *CacheModel        // nil leaves the hit ratio to the block
+	Replication  *Replication       // nil pools all replicas
+	ShardSkew    *ShardSkew         // nil spreads traffic evenly over shards
+	ReplicaSizes []float64          // relative replica capacities; missing ones are 1
+	DownReplicas int                // how many replicas, counted from the last, are down
+	params       map[string]float64 // per-node parameter overrides, see ScaleProfile
+	zipf         []zipfBucket       // CacheModel's key popularity, see zipfBuckets
+	outgoing     []OutEdge
+	asyncFrom    []string     // sources of async edges into this node
+	backsCache   bool         // target of a caching-pattern edge
+	balancedIn   bool         // target of an edge with a balancing algorithm
+	healthCheck  *HealthCheck // probes from an incoming edge, if any
 }
 
 type Graph struct {
 	nodes    map[string]*Node
+	ids      []string // block IDs in topology order, for deterministic iteration
 	incoming map[string]int
 }
 
@@ -36,6 +58,55 @@ type TopoBlock struct {
 	Replicas int    `json:"replicas,omitempty"`
 	Shards   int    `json:"shards,omitempty"`
 	CPUCores int    `json:"cpu_cores,omitempty"`
+
+	// Instance names a catalog instance type (see package instances) that
+	// supplies the per-replica CPU, memory, network and disk.
+	Instance string `json:"instance,omitempty"`
+
+	// Disk selects the storage media: local NVMe, HDD, or a network volume
+	// with burst credits. Blocks without a disk ignore it.
+	Disk *DiskSpec `json:"disk,omitempty"`
+
+	// Durability replaces the block's fsync policy: none, batch or per-write.
+	Durability blocks.Durability `json:"durability,omitempty"`
+
+	// CacheModel derives a cache's hit ratio from its working set: key
+	// space, object size, Zipf skew and eviction policy.
+	CacheModel *CacheModel `json:"cache_model,omitempty"`
+
+	// Replication makes one of the replicas a primary that takes all writes
+	// and the rest read replicas, with replication lag and failover.
+	Replication *Replication `json:"replication,omitempty"`
+
+	// ShardSkew spreads traffic unevenly over the shards, which are then
+	// simulated as separate queues.
+	ShardSkew *ShardSkew `json:"shard_skew,omitempty"`
+
+	// Balance is the load-balancing algorithm for the block's outgoing
+	// edges, e.g. a load balancer's; an edge's own Balance wins.
+	Balance string `json:"balance,omitempty"`
+
+	// ReplicaSizes gives each replica's capacity relative to the block's
+	// profile, e.g. [2, 1, 1] for one double-size instance. Replicas of
+	// different sizes are simulated one by one.
+	ReplicaSizes []float64 `json:"replica_sizes,omitempty"`
+
+	// DownReplicas kills that many of the block's replicas, counted from
+	// the last, while the rest keep serving.
+	DownReplicas int `json:"down_replicas,omitempty"`
+
+	// HealthCheck probes the replicas behind the block's outgoing edges,
+	// e.g. a load balancer's, and takes failing ones out of rotation; an
+	// edge's own HealthCheck wins.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// Overrides replaces Profile fields for this node, keyed by the Param*
+	// constants, e.g. {"memory_mb": 65536, "buffer_pool_ratio": 0.97}.
+	Overrides map[string]float64 `json:"overrides,omitempty"`
+
+	// Canvas position, carried for saved topologies; ignored by the engine.
+	X float64 `json:"x,omitempty"`
+	Y float64 `json:"y,omitempty"`
 }
 
 type TopoEdge struct {
@@ -44,6 +115,27 @@ type TopoEdge struct {
 	Weight     float64 `json:"weight,omitempty"`
 	Multiplier float64 `json:"multiplier,omitempty"`
 	LatencyMs  float64 `json:"latency_ms,omitempty"`
+
+	// Async makes the edge consumer-group style: the source keeps a durable
+	// backlog and the target pulls from it at its own capacity.
+	Async bool `json:"async,omitempty"`
+
+	// Ops restricts the edge to "reads" or "writes", e.g. a service sends
+	// only reads to its cache and only writes to its event log.
+	Ops string `json:"ops,omitempty"`
+
+	// Cache declares the caching pattern between a cache and the store
+	// behind it: cache-aside, write-through or write-behind.
+	Cache string `json:"cache,omitempty"`
+
+	// Balance spreads the edge's traffic over the target's replicas, which
+	// are then simulated one by one: round-robin, random,
+	// least-connections, power-of-two-choices or consistent-hash.
+	Balance string `json:"balance,omitempty"`
+
+	// HealthCheck probes the target's replicas and takes failing ones out
+	// of the edge's rotation.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
 }
 
 type Topology struct {
@@ -59,6 +151,7 @@ func BuildGraph(topo Topology) (*Graph, error) {
 		incoming: make(map[string]int),
 	}
 
+	topoBlocks := make(map[string]TopoBlock, len(topo.Blocks))
 	for _, b := range topo.Blocks {
 		replicas := b.Replicas
 		if replicas < 1 {
@@ -68,16 +161,90 @@ func BuildGraph(topo Topology) (*Graph, error) {
 		if shards < 1 {
 			shards = 1
 		}
+		if b.Instance != "" {
+			if _, ok := instances.Get(b.Instance); !ok {
+				return nil, fmt.Errorf("block %q: unknown instance type %q", b.ID, b.Instance)
+			}
+		}
+		var disk *DiskSpec
+		if b.Disk != nil {
+			if err := b.Disk.validate(); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+			d := b.Disk.withDefaults()
+			disk = &d
+		}
+		if err := checkDurability(b.Durability); err != nil {
+			return nil, fmt.Errorf("block %q: %w", b.ID, err)
+		}
+		var model *CacheModel
+		var zipf []zipfBucket
+		if b.CacheModel != nil {
+			if err := b.CacheModel.validate(); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+			m := b.CacheModel.withDefaults()
+			model = &m
+			zipf = zipfBuckets(m.KeySpace, *m.ZipfS)
+		}
+		var replication *Replication
+		if b.Replication != nil {
+			if err := b.Replication.validate(); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+			r := b.Replication.withDefaults()
+			replication = &r
+		}
+		if b.ShardSkew != nil {
+			if err := b.ShardSkew.validate(); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+		}
+		if err := checkBalance(b.Balance); err != nil {
+			return nil, fmt.Errorf("block %q: %w", b.ID, err)
+		}
+		if err := checkReplicas(b); err != nil {
+			return nil, fmt.Errorf("block %q: %w", b.ID, err)
+		}
+		if err := checkShards(b); err != nil {
+			return nil, fmt.Errorf("block %q: %w", b.ID, err)
+		}
+		if b.HealthCheck != nil {
+			if err := b.HealthCheck.validate(); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+		}
+		params := make(map[string]float64, len(b.Overrides))
+		for k, v := range b.Overrides {
+			if err := checkParam(k, v); err != nil {
+				return nil, fmt.Errorf("block %q: %w", b.ID, err)
+			}
+			params[k] = v
+		}
+		if _, dup := g.nodes[b.ID]; !dup {
+			g.ids = append(g.ids, b.ID)
+		}
 		g.nodes[b.ID] = &Node{
-			ID:       b.ID,
-			Kind:     b.Kind,
-			Name:     b.Name,
-			Dead:     b.Dead,
-			Replicas: replicas,
-			Shards:   shards,
-			CPUCores: b.CPUCores,
+			ID:           b.ID,
+			Kind:         b.Kind,
+			Name:         b.Name,
+			Dead:         b.Dead,
+			Replicas:     replicas,
+			Shards:       shards,
+			CPUCores:     b.CPUCores,
+			Instance:     b.Instance,
+			Disk:         disk,
+			Durability:   b.Durability,
+			CacheModel:   model,
+			Replication:  replication,
+			ShardSkew:    b.ShardSkew,
+			ReplicaSizes: b.ReplicaSizes,
+			DownReplicas: b.DownReplicas,
+			params:       params,
+			zipf:         zipf,
 		}
 		g.incoming[b.ID] = 0
+		topoBlocks[b.ID] = b
 	}
 
 	for _, e := range topo.Edges {
@@ -88,6 +255,25 @@ func BuildGraph(topo Topology) (*Graph, error) {
 		if _, ok := g.nodes[e.To]; !ok {
 			return nil, fmt.Errorf("unknown block %q in edge", e.To)
 		}
+		if err := checkOps(e.Ops); err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edgeID(e), err)
+		}
+		if err := checkCachePattern(e); err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edgeID(e), err)
+		}
+		algo := edgeBalance(e, topoBlocks[e.From])
+		if err := checkBalance(e.Balance); err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edgeID(e), err)
+		}
+		hc := edgeHealthCheck(e, topoBlocks[e.From])
+		if e.HealthCheck != nil {
+			if err := e.HealthCheck.validate(); err != nil {
+				return nil, fmt.Errorf("edge %s: %w", edgeID(e), err)
+			}
+		}
+		if err := checkBalanceTarget(algo, hc, topoBlocks[e.To]); err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edgeID(e), err)
+		}
 		w := e.Weight
 		if w <= 0 {
 			w = 1.0
@@ -96,13 +282,49 @@ func BuildGraph(topo Topology) (*Graph, error) {
 		if m <= 0 {
 			m = 1.0
 		}
-		from.outgoing = append(from.outgoing, OutEdge{To: e.To, Weight: w, Multiplier: m, LatencyMs: e.LatencyMs})
+		from.outgoing = append(from.outgoing, OutEdge{To: e.To, Weight: w, Multiplier: m, LatencyMs: e.LatencyMs, Async: e.Async, Ops: e.Ops, Cache: e.Cache, Balance: algo})
 		g.incoming[e.To]++
+		if e.Cache != "" {
+			g.nodes[e.To].backsCache = true
+		}
+		if algo != "" {
+			g.nodes[e.To].balancedIn = true
+		}
+		if hc != nil && g.nodes[e.To].healthCheck == nil {
+			h := hc.withDefaults()
+			g.nodes[e.To].healthCheck = &h
+		}
+		if e.Async {
+			g.nodes[e.To].asyncFrom = append(g.nodes[e.To].asyncFrom, e.From)
+		}
 	}
 
 	return g, nil
 }
 
+// clone returns a deep copy of the graph so callers can perturb node
+// parameters without affecting the original.
+func (g *Graph) clone() *Graph {
+	c := &Graph{
+		nodes:    make(map[string]*Node, len(g.nodes)),
+		ids:      g.ids,
+		incoming: make(map[string]int, len(g.incoming)),
+	}
+	for id, n := range g.nodes {
+		cn := *n
+		cn.outgoing = append([]OutEdge(nil), n.outgoing...)
+		cn.params = make(map[string]float64, len(n.params))
+		for k, v := range n.params {
+			cn.params[k] = v
+		}
+		c.nodes[id] = &cn
+	}
+	for id, d := range g.incoming {
+		c.incoming[id] = d
+	}
+	return c
+}
+
 func (g *Graph) Node(id string) *Node {
 	return g.nodes[id]
 }
@@ -121,15 +343,16 @@ func (g *Graph) Downstream(id string) []*Node {
 
 func (g *Graph) Sources() []*Node {
 	var srcs []*Node
-	for id, count := range g.incoming {
-		if count == 0 {
+	for _, id := range g.ids {
+		if g.incoming[id] == 0 {
 			srcs = append(srcs, g.nodes[id])
 		}
 	}
 	return srcs
 }
 
-// TopoOrder returns node IDs in topological order (Kahn's algorithm).
+// TopoOrder returns node IDs in topological order (Kahn's algorithm), with
+// ties broken by topology order so repeated runs are identical.
 // Returns an error if the graph contains a cycle.
 func (g *Graph) TopoOrder() ([]string, error) {
 	deg := make(map[string]int, len(g.incoming))
@@ -138,8 +361,8 @@ func (g *Graph) TopoOrder() ([]string, error) {
 	}
 
 	var queue []string
-	for id, d := range deg {
-		if d == 0 {
+	for _, id := range g.ids {
+		if deg[id] == 0 {
 			queue = append(queue, id)
 		}
 	}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	defaultCheckIntervalS     = 5
+	defaultUnhealthyThreshold = 3
+	defaultHealthyThreshold   = 2
+	defaultCheckTimeoutMs     = 2000
+
+	// minCheckIntervalS is the shortest probe interval: one tick at the
+	// default dt. Probes run at most once a tick regardless.
+	minCheckIntervalS = tickDt
+)
+
+// Engine-owned BlockState.Extra keys for health-checked nodes.
+const (
+	stateCheckClock     = "hc_clock"     // seconds since the last probe round
+	stateCheckWindow    = "hc_window_s"  // length of the current or last detection window
+	stateCheckLost      = "hc_lost"      // requests lost during that window
+	stateCheckDetecting = "hc_detecting" // 1 while a failing replica is still in rotation
+
+	checkFailsPrefix      = "hc_fails:"         // consecutive failed probes
+	checkPassesPrefix     = "hc_passes:"        // consecutive passed probes while out of rotation
+	checkOutPrefix        = "hc_out:"           // 1 once out of rotation
+	checkEvictInPrefix    = "hc_evict_in:"      // seconds until a failing probe times out and evicts
+	replicaLatencyPrefix  = "replica_latency:"  // last tick's latency, which probes see
+	replicaDroppingPrefix = "replica_dropping:" // 1 if the replica dropped requests last tick
+)
+
+// HealthCheck probes each replica behind a load balancer every IntervalS
+// seconds. A probe fails when the replica is down, dropping requests or
+// slower than TimeoutMs, and takes the full timeout to fail.
+// UnhealthyThreshold failures in a row take the replica out of rotation;
+// HealthyThreshold passes bring it back.
+type HealthCheck struct {
+	IntervalS          float64 `json:"interval_s,omitempty"`
+	UnhealthyThreshold int     `json:"unhealthy_threshold,omitempty"`
+	HealthyThreshold   int     `json:"healthy_threshold,omitempty"`
+	TimeoutMs          float64 `json:"timeout_ms,omitempty"`
+}
+
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.IntervalS == 0 {
+		h.IntervalS = defaultCheckIntervalS
+	}
+	if h.UnhealthyThreshold == 0 {
+		h.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if h.HealthyThreshold == 0 {
+		h.HealthyThreshold = defaultHealthyThreshold
+	}
+	if h.TimeoutMs == 0 {
+		h.TimeoutMs = defaultCheckTimeoutMs
+	}
+	return h
+}
+
+func (h HealthCheck) validate() error {
+	if math.IsNaN(h.IntervalS) || h.IntervalS < 0 || (h.IntervalS > 0 && h.IntervalS < minCheckIntervalS) {
+		return fmt.Errorf("health check interval_s = %g below %gs", h.IntervalS, float64(minCheckIntervalS))
+	}
+	if math.IsNaN(h.TimeoutMs) || h.TimeoutMs < 0 {
+		return fmt.Errorf("health check timeout_ms = %g below 0", h.TimeoutMs)
+	}
+	if h.UnhealthyThreshold < 0 || h.HealthyThreshold < 0 {
+		return fmt.Errorf("health check thresholds must not be negative")
+	}
+	return nil
+}
+
+// edgeHealthCheck is the health check an edge probes its target with: its
+// own, or else its source block's. Async edges are never checked.
+func edgeHealthCheck(e TopoEdge, from TopoBlock) *HealthCheck {
+	if e.Async {
+		return nil
+	}
+	if e.HealthCheck != nil {
+		return e.HealthCheck
+	}
+	return from.HealthCheck
+}
+
+// replicaFailing reports whether a probe to replica i would fail now.
+func replicaFailing(node *Node, bs *BlockState, i int) bool {
+	return replicaDown(node, i) || bs.Extra[replicaDroppingPrefix+strconv.Itoa(i)] > 0 ||
+		bs.Extra[replicaLatencyPrefix+strconv.Itoa(i)] > node.healthCheck.TimeoutMs
+}
+
+// probeReplicas advances the node's health checks by dt and returns which
+// replicas are in rotation. Without health checks every replica is.
+func probeReplicas(node *Node, bs *BlockState, dt float64) []bool {
+	rotation := make([]bool, node.Replicas)
+	hc := node.healthCheck
+	if hc == nil {
+		for i := range rotation {
+			rotation[i] = true
+		}
+		return rotation
+	}
+	key := func(prefix string, i int) string { return prefix + strconv.Itoa(i) }
+
+	// Failed probes evict once their timeout runs out.
+	for i := range rotation {
+		if in := bs.Extra[key(checkEvictInPrefix, i)]; in > 0 {
+			if in -= dt; in <= flushSlack {
+				bs.Extra[key(checkOutPrefix, i)] = 1
+				bs.Extra[key(checkPassesPrefix, i)] = 0
+				in = 0
+			}
+			bs.Extra[key(checkEvictInPrefix, i)] = in
+		}
+	}
+	// Every probe due this tick sees the same replicas, so a tick longer
+	// than the interval runs one round and carries the remainder over.
+	bs.Extra[stateCheckClock] += dt
+	if due := math.Floor((bs.Extra[stateCheckClock] + flushSlack) / hc.IntervalS); due >= 1 {
+		bs.Extra[stateCheckClock] = max(0, bs.Extra[stateCheckClock]-due*hc.IntervalS)
+		for i := range rotation {
+			failing := replicaFailing(node, bs, i)
+			switch {
+			case bs.Extra[key(checkOutPrefix, i)] == 0 && failing:
+				bs.Extra[key(checkFailsPrefix, i)]++
+				if bs.Extra[key(checkFailsPrefix, i)] >= float64(hc.UnhealthyThreshold) && bs.Extra[key(checkEvictInPrefix, i)] == 0 {
+					bs.Extra[key(checkEvictInPrefix, i)] = max(hc.TimeoutMs/1000, flushSlack)
+				}
+			case bs.Extra[key(checkOutPrefix, i)] == 0:
+				bs.Extra[key(checkFailsPrefix, i)] = 0
+			case failing:
+				bs.Extra[key(checkPassesPrefix, i)] = 0
+			default:
+				bs.Extra[key(checkPassesPrefix, i)]++
+				if bs.Extra[key(checkPassesPrefix, i)] >= float64(hc.HealthyThreshold) {
+					bs.Extra[key(checkOutPrefix, i)] = 0
+					bs.Extra[key(checkFailsPrefix, i)] = 0
+				}
+			}
+		}
+	}
+	for i := range rotation {
+		rotation[i] = bs.Extra[key(checkOutPrefix, i)] == 0
+	}
+	return rotation
+}
+
+// trackDetection records how the replicas did this tick for the next probes
+// and times the detection window: from a replica in rotation starting to fail
+// until every failing replica is out of rotation. It returns the window so
+// far, or the last one, and the requests lost on failing replicas during it:
+// those dropped, and on a replica slower than the check's timeout, those
+// answered too late as well.
+func trackDetection(node *Node, bs *BlockState, rs []ReplicaResult, parts []partLoad, dt float64) (windowS, lost float64) {
+	detecting := false
+	for i, r := range rs {
+		bs.Extra[replicaLatencyPrefix+strconv.Itoa(i)] = r.Latency
+		bs.Extra[replicaDroppingPrefix+strconv.Itoa(i)] = 0
+		if r.Dropped > 0 {
+			bs.Extra[replicaDroppingPrefix+strconv.Itoa(i)] = 1
+		}
+		if !r.Evicted && replicaFailing(node, bs, i) {
+			detecting = true
+		}
+	}
+	if detecting {
+		if bs.Extra[stateCheckDetecting] == 0 {
+			bs.Extra[stateCheckDetecting] = 1
+			bs.Extra[stateCheckWindow] = 0
+			bs.Extra[stateCheckLost] = 0
+		}
+		bs.Extra[stateCheckWindow] += dt
+		for i, r := range rs {
+			if !r.Evicted && replicaFailing(node, bs, i) {
+				bs.Extra[stateCheckLost] += parts[i].dropped
+				if r.Latency > node.healthCheck.TimeoutMs {
+					bs.Extra[stateCheckLost] += parts[i].processed
+				}
+			}
+		}
+	} else {
+		bs.Extra[stateCheckDetecting] = 0
+	}
+	return bs.Extra[stateCheckWindow], bs.Extra[stateCheckLost]
+}
+
+func countTrue(bs []bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package engine
+
+import "testing"
+
+func checkedGraph(t *testing.T, hc *HealthCheck, sizes []float64) *Graph {
+	t.Helper()
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "lb", Kind: "load_balancer", Balance: BalanceRoundRobin, HealthCheck: hc},
+			{ID: "svc", Kind: "service", Replicas: 3, ReplicaSizes: sizes},
+		},
+		Edges: []TopoEdge{{From: "u", To: "lb"}, {From: "lb", To: "svc"}},
+	})
+}
+
+func TestDeadReplicaEvictedAfterDetection(t *testing.T) {
+	g := checkedGraph(t, &HealthCheck{IntervalS: 1, UnhealthyThreshold: 3, HealthyThreshold: 2, TimeoutMs: 500}, nil)
+	rps := 0.3 * 3 * instanceCapacity(t)
+	state := NewSimState(g)
+	for range 10 {
+		SimulateTick(g, rps, 1, state)
+	}
+	g.Node("svc").DownReplicas = 1
+	var svc BlockResult
+	evictedAt := 0
+	for tick := 1; tick <= 60 && evictedAt == 0; tick++ {
+		results, _ := SimulateTick(g, rps, 1, state)
+		svc = results[2]
+		if svc.Replicas[2].Evicted {
+			evictedAt = tick
+		} else if svc.Health != "red" || !approx(svc.Dropped, rps*0.1/3) {
+			t.Fatalf("tick %d: the dead replica should lose its third until evicted, got %s dropped=%g", tick, svc.Health, svc.Dropped)
+		}
+	}
+	// Three failed probes a second apart, the first within a second of the
+	// crash, and the last one's 0.5s timeout.
+	window := svc.Metrics["detection_window_s"]
+	if window < 2.5 || window > 3.6 {
+		t.Errorf("detection window should be 2.5-3.5s, got %gs", window)
+	}
+	if lost := svc.Metrics["detection_lost"]; !approx(lost, window*rps/3) {
+		t.Errorf("a third of %gs of traffic should be lost, got %g", window, lost)
+	}
+
+	results, _ := SimulateTick(g, rps, 1, state)
+	svc = results[2]
+	if svc.Dropped > 0 || svc.Metrics["in_rotation"] != 2 || svc.Health == "red" {
+		t.Errorf("the live replicas should take all the traffic once evicted, got %+v", svc)
+	}
+	if !approx(svc.Metrics["detection_window_s"], window) {
+		t.Errorf("the last window should stay reported, got %g", svc.Metrics["detection_window_s"])
+	}
+
+	// Back after two passing probes.
+	g.Node("svc").DownReplicas = 0
+	for range 20 {
+		results, _ = SimulateTick(g, rps, 1, state)
+	}
+	if svc = results[2]; svc.Metrics["in_rotation"] != 3 || svc.Replicas[2].Evicted {
+		t.Errorf("a recovered replica should rejoin, got %g in rotation", svc.Metrics["in_rotation"])
+	}
+}
+
+func TestDeadReplicaWithoutHealthCheckLosesItsShare(t *testing.T) {
+	g := checkedGraph(t, nil, nil)
+	g.Node("svc").DownReplicas = 1
+	rps := 0.3 * 3 * instanceCapacity(t)
+	svc := runBalanced(t, g, rps, 200)
+	if !approx(svc.Dropped, rps*0.1/3) || svc.Replicas[2].Evicted {
+		t.Errorf("without health checks the dead replica should keep its share, dropped %g", svc.Dropped)
+	}
+
+	results, err := Simulate(g, rps, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(results[2].Dropped, rps/3) || !approx(results[2].RPS, rps) {
+		t.Errorf("static model should drop the dead replica's third, got %g", results[2].Dropped)
+	}
+	checked := checkedGraph(t, &HealthCheck{}, nil)
+	checked.Node("svc").DownReplicas = 1
+	if results, _ = Simulate(checked, rps, 1); results[2].Dropped != 0 || !approx(results[2].Bottleneck, 0.3*1.5) {
+		t.Errorf("health checks should leave two replicas with half as much again, got dropped=%g bottleneck=%g",
+			results[2].Dropped, results[2].Bottleneck)
+	}
+}
+
+func TestSlowReplicaFailsHealthChecks(t *testing.T) {
+	// A fifth-size replica under round-robin fills its queue and drops.
+	g := checkedGraph(t, &HealthCheck{IntervalS: 1, UnhealthyThreshold: 2, TimeoutMs: 200}, []float64{1, 1, 0.2})
+	rps := 0.4 * 3 * instanceCapacity(t)
+	state := NewSimState(g)
+	for range 300 {
+		results, _ := SimulateTick(g, rps, 1, state)
+		if results[2].Replicas[2].Evicted {
+			return
+		}
+	}
+	t.Error("the slow replica should be taken out of rotation")
+}
+
+func TestSlowReplicaLosesItsTrafficWhileDetected(t *testing.T) {
+	// Replica 2 drops nothing but answers past the 200ms timeout, so
+	// everything it serves until evicted counts as lost.
+	g := checkedGraph(t, &HealthCheck{IntervalS: 1, UnhealthyThreshold: 3, TimeoutMs: 200}, nil)
+	bs := NewSimState(g).Blocks["svc"]
+	rs := []ReplicaResult{{Latency: 5}, {Latency: 5}, {Latency: 500}}
+	parts := []partLoad{{processed: 100}, {processed: 100}, {processed: 100}}
+	var window, lost float64
+	for range 2 {
+		window, lost = trackDetection(g.Node("svc"), bs, rs, parts, 1)
+	}
+	if window != 2 || lost != 200 {
+		t.Errorf("two ticks of the slow replica's 100 requests should be lost, got %g over %gs", lost, window)
+	}
+
+	// Evicted, it no longer counts; the window closes with what it lost.
+	rs[2].Evicted = true
+	if window, lost = trackDetection(g.Node("svc"), bs, rs, parts, 1); window != 2 || lost != 200 {
+		t.Errorf("the last window should stay reported, got %g over %gs", lost, window)
+	}
+}
+
+func TestHealthCheckRejected(t *testing.T) {
+	for _, hc := range []HealthCheck{{IntervalS: -1}, {IntervalS: 1e-9}, {TimeoutMs: -5}, {UnhealthyThreshold: -1}} {
+		topo := Topology{Blocks: []TopoBlock{{ID: "lb", Kind: "load_balancer", HealthCheck: &hc}}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%+v: BuildGraph should fail", hc)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_health_check" {
+			t.Errorf("%+v: Validate should report bad_health_check, got %+v", hc, r.Errors)
+		}
+	}
+	topo := Topology{Blocks: []TopoBlock{{ID: "svc", Kind: "service", Replicas: 2, DownReplicas: 3}}}
+	if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_replicas" {
+		t.Errorf("more down replicas than replicas should be rejected, got %+v", r.Errors)
+	}
+}
+
+func TestProbesRunOncePerTick(t *testing.T) {
+	// Past validation, a tick far longer than the interval still runs a
+	// single round of probes rather than one per elapsed interval.
+	g := checkedGraph(t, &HealthCheck{IntervalS: 1, UnhealthyThreshold: 3}, nil)
+	g.Node("svc").healthCheck.IntervalS = 1e-9
+	g.Node("svc").DownReplicas = 1
+	state := NewSimState(g)
+	state.Dt = 10
+	SimulateTick(g, 1000, 1, state)
+	if fails := state.Blocks["svc"].Extra[checkFailsPrefix+"2"]; fails != 1 {
+		t.Errorf("one probe round should run per tick, got %g failures", fails)
+	}
+}
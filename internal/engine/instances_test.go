@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+)
+
+func TestInstanceTimesReplicas(t *testing.T) {
+	g, err := BuildGraph(Topology{Blocks: []TopoBlock{
+		{ID: "db", Kind: "sql_datastore", Instance: "m5.xlarge", Replicas: 3},
+		{ID: "svc", Kind: "service", Instance: "m5.xlarge"},
+		{ID: "big", Kind: "sql_datastore", Instance: "m5.xlarge", Overrides: map[string]float64{ParamMemoryMB: 1024}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := blocks.ByKind("sql_datastore")
+	svc, _ := blocks.ByKind("service")
+
+	p := ScaleProfile(sql.Profile(), g.Node("db"))
+	if p.CPUCores != 12 || p.MemoryMB != 3*16384 || p.DiskIOPS != 3*3000 || p.NetworkMBps != 3*1250 {
+		t.Errorf("3 x m5.xlarge: got %d cores, %d MB, %d IOPS, %g MB/s", p.CPUCores, p.MemoryMB, p.DiskIOPS, p.NetworkMBps)
+	}
+	if p := ScaleProfile(svc.Profile(), g.Node("svc")); p.DiskIOPS != 0 {
+		t.Errorf("a diskless block should stay diskless on any instance, got %d IOPS", p.DiskIOPS)
+	}
+	if p := ScaleProfile(sql.Profile(), g.Node("big")); p.MemoryMB != 1024 || p.CPUCores != 4 {
+		t.Errorf("overrides should win over the instance: %+v", p)
+	}
+}
+
+func TestInstanceNetworkBound(t *testing.T) {
+	// 1000 MB/s at 4KB per read caps a service at 250k RPS, below its 320k
+	// RPS CPU capacity on 64 cores.
+	g, _ := BuildGraph(Topology{Blocks: []TopoBlock{{ID: "svc", Kind: "service", CPUCores: 64,
+		Overrides: map[string]float64{ParamNetworkMBps: 1000}}}})
+	if c := nodeCapacity(g.Node("svc"), 1); math.Abs(c-250000) > 1 {
+		t.Errorf("expected network-bound 250000 RPS, got %g", c)
+	}
+	results, _ := Simulate(g, 200000, 1)
+	if u := results[0].NetUtil; math.Abs(u-0.8) > 1e-9 || results[0].Bottleneck < u {
+		t.Errorf("expected 80%% network utilization as the bottleneck, got %+v", results[0])
+	}
+}
+
+func TestUnknownInstance(t *testing.T) {
+	topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Instance: "z9.mega"}}}
+	if _, err := BuildGraph(topo); err == nil || !strings.Contains(err.Error(), "z9.mega") {
+		t.Errorf("expected unknown instance error, got %v", err)
+	}
+	if Validate(topo).OK() {
+		t.Error("validation should reject an unknown instance")
+	}
+}
+
+func TestCost(t *testing.T) {
+	g, _ := BuildGraph(Topology{Blocks: []TopoBlock{
+		{ID: "u", Kind: "user"},
+		{ID: "svc", Kind: "service", Instance: "c5.xlarge", Replicas: 4},
+		{ID: "db", Kind: "sql_datastore", Instance: "r6g.2xlarge"},
+		{ID: "blob", Kind: "s3"},
+	}})
+	c := Cost(g)
+	want := 4*0.17 + 0.4032
+	if math.Abs(c.HourlyUSD-want) > 1e-9 || math.Abs(c.MonthlyUSD-want*hoursPerMonth) > 1e-6 {
+		t.Errorf("want $%g/h, got %+v", want, c)
+	}
+	if len(c.Unpriced) != 1 || c.Unpriced[0] != "blob" {
+		t.Errorf("s3 has no instance and should be unpriced, got %v", c.Unpriced)
+	}
+}
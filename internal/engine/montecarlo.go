@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultMCRuns  = 200
+	defaultMCTicks = 100
+	maxMCRuns      = 10000
+	maxMCTicks     = 10000
+	maxMCRunTicks  = 1_000_000 // runs × ticks, so one call cannot tie up the server
+	maxMCRPS       = 1e9       // search ceiling for topologies that never go red
+)
+
+// Dist is a range or distribution for an uncertain parameter.
+// An empty Kind with only Value set is a point estimate. Min and Max bound
+// uniform and triangular draws, where an unset bound is 0, and clamp normal
+// draws on whichever side is set.
+type Dist struct {
+	Kind   string   `json:"kind,omitempty"` // "", "uniform", "normal", "triangular"
+	Value  float64  `json:"value,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Mode   float64  `json:"mode,omitempty"`
+	Mean   float64  `json:"mean,omitempty"`
+	StdDev float64  `json:"stddev,omitempty"`
+}
+
+// span returns the uniform or triangular range, taking an unset bound as 0.
+func (d Dist) span() (lo, hi float64) {
+	if d.Min != nil {
+		lo = *d.Min
+	}
+	if d.Max != nil {
+		hi = *d.Max
+	}
+	return lo, hi
+}
+
+func (d Dist) validate() error {
+	lo, hi := d.span()
+	switch d.Kind {
+	case "":
+	case "uniform":
+		if hi < lo {
+			return fmt.Errorf("uniform: max %g < min %g", hi, lo)
+		}
+	case "triangular":
+		if hi < lo || d.Mode < lo || d.Mode > hi {
+			return fmt.Errorf("triangular: need min <= mode <= max, got %g/%g/%g", lo, d.Mode, hi)
+		}
+	case "normal":
+		if d.StdDev < 0 {
+			return fmt.Errorf("normal: negative stddev %g", d.StdDev)
+		}
+		if d.Min != nil && d.Max != nil && *d.Max < *d.Min {
+			return fmt.Errorf("normal: max %g < min %g", *d.Max, *d.Min)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", d.Kind)
+	}
+	return nil
+}
+
+// Sample draws one value. Normal samples are clamped to Min and Max where
+// each is set, so a ratio cannot wander outside 0..1.
+func (d Dist) Sample(r *rand.Rand) float64 {
+	lo, hi := d.span()
+	switch d.Kind {
+	case "uniform":
+		return lo + r.Float64()*(hi-lo)
+	case "triangular":
+		if hi == lo {
+			return lo
+		}
+		u := r.Float64()
+		c := (d.Mode - lo) / (hi - lo)
+		if u < c {
+			return lo + math.Sqrt(u*(hi-lo)*(d.Mode-lo))
+		}
+		return hi - math.Sqrt((1-u)*(hi-lo)*(hi-d.Mode))
+	case "normal":
+		v := d.Mean + r.NormFloat64()*d.StdDev
+		if d.Min != nil {
+			v = math.Max(v, *d.Min)
+		}
+		if d.Max != nil {
+			v = math.Min(v, *d.Max)
+		}
+		return v
+	default:
+		return d.Value
+	}
+}
+
+// UncertainParam perturbs one per-node parameter (see the Param* keys).
+// Block selects a single node; Kind selects every node of that kind.
+type UncertainParam struct {
+	Block string `json:"block,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	Param string `json:"param"`
+	Dist  Dist   `json:"dist"`
+}
+
+type MonteCarloConfig struct {
+	Runs      int              `json:"runs"`
+	Seed      uint64           `json:"seed"`
+	Ticks     int              `json:"ticks"` // ticks per run before health is read
+	RPS       *Dist            `json:"rps,omitempty"`
+	ReadRatio *Dist            `json:"read_ratio,omitempty"`
+	Params    []UncertainParam `json:"params,omitempty"`
+}
+
+// MonteCarloResult summarizes the outcome distribution across runs.
+// A run "goes red" when any block is red or dropping requests on its final
+// tick — overloaded blocks shed work rather than report 100% CPU. MaxRPS is the
+// highest source RPS a run's sampled system sustains with no red block.
+type MonteCarloResult struct {
+	Runs      int                `json:"runs"`
+	PRed      float64            `json:"p_red"`
+	BlockPRed map[string]float64 `json:"block_p_red"`
+	MaxRPSP5  float64            `json:"max_rps_p5"`
+	MaxRPSP50 float64            `json:"max_rps_p50"`
+	MaxRPSP95 float64            `json:"max_rps_p95"`
+}
+
+type mcRun struct {
+	red    bool
+	redIDs []string
+	maxRPS float64
+}
+
+// MonteCarlo runs cfg.Runs seeded simulations of topo in parallel, each with
+// parameters drawn from their distributions. The same seed always yields the
+// same result regardless of scheduling.
+func MonteCarlo(topo Topology, cfg MonteCarloConfig) (*MonteCarloResult, error) {
+	base, err := BuildGraph(topo)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := base.TopoOrder(); err != nil {
+		return nil, err
+	}
+	if cfg.Runs <= 0 {
+		cfg.Runs = defaultMCRuns
+	}
+	if cfg.Runs > maxMCRuns {
+		return nil, fmt.Errorf("runs %d exceeds limit %d", cfg.Runs, maxMCRuns)
+	}
+	if cfg.Ticks <= 0 {
+		cfg.Ticks = defaultMCTicks
+	}
+	if cfg.Ticks > maxMCTicks {
+		return nil, fmt.Errorf("ticks %d exceeds limit %d", cfg.Ticks, maxMCTicks)
+	}
+	if cfg.Runs*cfg.Ticks > maxMCRunTicks {
+		return nil, fmt.Errorf("runs × ticks %d exceeds limit %d", cfg.Runs*cfg.Ticks, maxMCRunTicks)
+	}
+	for _, d := range []*Dist{cfg.RPS, cfg.ReadRatio} {
+		if d != nil {
+			if err := d.validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, up := range cfg.Params {
+		if _, ok := paramBounds[up.Param]; !ok {
+			return nil, fmt.Errorf("unknown param %q", up.Param)
+		}
+		if err := up.Dist.validate(); err != nil {
+			return nil, fmt.Errorf("param %s: %w", up.Param, err)
+		}
+		if up.Block != "" && base.Node(up.Block) == nil {
+			return nil, fmt.Errorf("unknown block %q in param", up.Block)
+		}
+	}
+
+	runs := make([]mcRun, cfg.Runs)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), cfg.Runs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				runs[i] = runMonteCarlo(base, topo, cfg, i)
+			}
+		}()
+	}
+	for i := range cfg.Runs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	res := &MonteCarloResult{Runs: cfg.Runs, BlockPRed: make(map[string]float64)}
+	maxRPS := make([]float64, 0, cfg.Runs)
+	for _, r := range runs {
+		if r.red {
+			res.PRed++
+		}
+		for _, id := range r.redIDs {
+			res.BlockPRed[id]++
+		}
+		maxRPS = append(maxRPS, r.maxRPS)
+	}
+	res.PRed /= float64(cfg.Runs)
+	for id := range res.BlockPRed {
+		res.BlockPRed[id] /= float64(cfg.Runs)
+	}
+	sort.Float64s(maxRPS)
+	res.MaxRPSP5 = percentile(maxRPS, 0.05)
+	res.MaxRPSP50 = percentile(maxRPS, 0.50)
+	res.MaxRPSP95 = percentile(maxRPS, 0.95)
+	return res, nil
+}
+
+func runMonteCarlo(base *Graph, topo Topology, cfg MonteCarloConfig, i int) mcRun {
+	r := rand.New(rand.NewPCG(cfg.Seed, uint64(i)))
+	g := base.clone()
+
+	rps := topo.RPS
+	if cfg.RPS != nil {
+		rps = math.Max(0, cfg.RPS.Sample(r))
+	}
+	readRatio := topo.ReadRatio
+	if cfg.ReadRatio != nil {
+		readRatio = math.Max(0, math.Min(1, cfg.ReadRatio.Sample(r)))
+	}
+	for _, up := range cfg.Params {
+		// One draw per parameter: nodes sharing a kind share the estimate.
+		// Tails past the parameter's range are clamped onto it.
+		v := paramBounds[up.Param].clamp(up.Dist.Sample(r))
+		for _, n := range g.nodes {
+			if n.ID == up.Block || (up.Block == "" && n.Kind == up.Kind) {
+				n.params[up.Param] = v
+			}
+		}
+	}
+
+	var run mcRun
+	state := NewSimState(g)
+	var results []BlockResult
+	for range cfg.Ticks {
+		results, _ = SimulateTick(g, rps, readRatio, state)
+	}
+	for _, br := range results {
+		if br.Health == "red" || br.Dropped > 0 {
+			run.red = true
+			run.redIDs = append(run.redIDs, br.ID)
+		}
+	}
+	run.maxRPS = maxHealthyRPS(g, readRatio)
+	return run
+}
+
+// maxHealthyRPS finds the highest source RPS at which the steady-state model
+// keeps every block out of the red, by doubling then bisecting.
+func maxHealthyRPS(g *Graph, readRatio float64) float64 {
+	healthy := func(rps float64) bool {
+		results, err := Simulate(g, rps, readRatio)
+		if err != nil {
+			return false
+		}
+		for _, br := range results {
+			if br.Health == "red" {
+				return false
+			}
+		}
+		return true
+	}
+	if !healthy(1) {
+		return 0
+	}
+	lo, hi := 1.0, 2.0
+	for healthy(hi) {
+		if hi >= maxMCRPS {
+			return maxMCRPS
+		}
+		lo, hi = hi, hi*2
+	}
+	for range 40 {
+		mid := (lo + hi) / 2
+		if healthy(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// percentile returns the p-th quantile of sorted values with linear
+// interpolation between ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestDistSampleBounds(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	lo, hi := 0.1, 0.3
+	dists := []Dist{
+		{Kind: "uniform", Min: &lo, Max: &hi},
+		{Kind: "triangular", Min: &lo, Mode: 0.2, Max: &hi},
+		{Kind: "normal", Mean: 0.2, StdDev: 1, Min: &lo, Max: &hi},
+	}
+	for _, d := range dists {
+		for range 1000 {
+			v := d.Sample(r)
+			if v < 0.1 || v > 0.3 {
+				t.Fatalf("%s: sample %g outside [0.1, 0.3]", d.Kind, v)
+			}
+		}
+	}
+	if v := (Dist{Value: 7}).Sample(r); v != 7 {
+		t.Errorf("point estimate: want 7, got %g", v)
+	}
+}
+
+func TestNormalDistOneSidedBound(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var d Dist
+	if err := json.Unmarshal([]byte(`{"kind": "normal", "mean": 500, "stddev": 50, "min": 100}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for range 1000 {
+		v := d.Sample(r)
+		if v < 100 {
+			t.Fatalf("sample %g below min 100", v)
+		}
+		sum += v
+	}
+	// Only the lower bound is set; draws stay spread around the mean.
+	if mean := sum / 1000; mean < 490 || mean > 510 {
+		t.Errorf("mean %g, want about 500", mean)
+	}
+
+	lo, hi := 0.3, 0.1
+	if err := (Dist{Kind: "normal", Mean: 0.2, Min: &lo, Max: &hi}).validate(); err == nil {
+		t.Error("min above max should be rejected")
+	}
+}
+
+func TestMonteCarloFixedMatchesCapacity(t *testing.T) {
+	// No uncertainty: every run sees the service's 20000 RPS read capacity.
+	// Red starts at 90% utilization, so max healthy RPS is ~18000.
+	topo := Topology{
+		Blocks:    []TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service"}},
+		Edges:     []TopoEdge{{From: "u", To: "s"}},
+		RPS:       1000,
+		ReadRatio: 1.0,
+	}
+	res, err := MonteCarlo(topo, MonteCarloConfig{Runs: 20, Ticks: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PRed != 0 {
+		t.Errorf("p_red: want 0 at 1000 RPS, got %g", res.PRed)
+	}
+	if res.MaxRPSP5 < 17900 || res.MaxRPSP95 > 18100 {
+		t.Errorf("max rps: want ~18000, got p5=%g p95=%g", res.MaxRPSP5, res.MaxRPSP95)
+	}
+}
+
+func TestMonteCarloCPUCostSpread(t *testing.T) {
+	// Read CPU cost between 0.1ms and 0.4ms → capacity 10k..40k RPS.
+	// At 15000 RPS some runs go red and the max RPS band is wide.
+	topo := Topology{
+		Blocks:    []TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service"}},
+		Edges:     []TopoEdge{{From: "u", To: "s"}},
+		RPS:       15000,
+		ReadRatio: 1.0,
+	}
+	minCPU, maxCPU := 0.1, 0.4
+	cfg := MonteCarloConfig{
+		Runs:  200,
+		Seed:  42,
+		Ticks: 20,
+		Params: []UncertainParam{{
+			Kind:  "service",
+			Param: ParamReadCPUMs,
+			Dist:  Dist{Kind: "uniform", Min: &minCPU, Max: &maxCPU},
+		}},
+	}
+	res, err := MonteCarlo(topo, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PRed <= 0.1 || res.PRed >= 0.9 {
+		t.Errorf("p_red: want a partial probability, got %g", res.PRed)
+	}
+	if res.BlockPRed["s"] != res.PRed {
+		t.Errorf("service should account for every red run, got %g vs %g", res.BlockPRed["s"], res.PRed)
+	}
+	if res.MaxRPSP95 < 2*res.MaxRPSP5 {
+		t.Errorf("max rps band too narrow: p5=%g p95=%g", res.MaxRPSP5, res.MaxRPSP95)
+	}
+
+	again, _ := MonteCarlo(topo, cfg)
+	if again.PRed != res.PRed || again.MaxRPSP50 != res.MaxRPSP50 {
+		t.Errorf("same seed should reproduce results: %+v vs %+v", again, res)
+	}
+}
+
+func TestMonteCarloHitRatioShieldsBackend(t *testing.T) {
+	// A 90% hit ratio on the cache lets SQL survive 10x more reads.
+	topo := Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "c", Kind: "redis"},
+			{ID: "db", Kind: "sql_datastore"},
+		},
+		Edges:     []TopoEdge{{From: "u", To: "c"}, {From: "c", To: "db"}},
+		ReadRatio: 1.0,
+	}
+	low, err := MonteCarlo(topo, MonteCarloConfig{Runs: 5, Ticks: 1, Params: []UncertainParam{
+		{Block: "c", Param: ParamHitRatio, Dist: Dist{Value: 0}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, _ := MonteCarlo(topo, MonteCarloConfig{Runs: 5, Ticks: 1, Params: []UncertainParam{
+		{Block: "c", Param: ParamHitRatio, Dist: Dist{Value: 0.9}},
+	}})
+	if high.MaxRPSP50 < 5*low.MaxRPSP50 {
+		t.Errorf("hit ratio should raise max rps: 0%%=%g 90%%=%g", low.MaxRPSP50, high.MaxRPSP50)
+	}
+}
+
+func TestMonteCarloClampsSamplesToBounds(t *testing.T) {
+	// About a third of the draws fall below zero read CPU. Clamped, they
+	// run at zero; unclamped, a negative read cost would offset the writes'
+	// and lift capacity past the zero-cost ceiling.
+	topo := Topology{
+		Blocks:    []TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service"}},
+		Edges:     []TopoEdge{{From: "u", To: "s"}},
+		ReadRatio: 0.5,
+	}
+	run := func(d Dist) *MonteCarloResult {
+		res, err := MonteCarlo(topo, MonteCarloConfig{Runs: 100, Ticks: 1, Params: []UncertainParam{
+			{Block: "s", Param: ParamReadCPUMs, Dist: d},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	floor := run(Dist{Value: 0})
+	mixed := run(Dist{Kind: "normal", Mean: 0.2, StdDev: 0.4})
+	if !approx(mixed.MaxRPSP95, floor.MaxRPSP95) {
+		t.Errorf("draws below zero should run at zero: p95 %g vs %g", mixed.MaxRPSP95, floor.MaxRPSP95)
+	}
+	if mixed.MaxRPSP5 >= floor.MaxRPSP5 {
+		t.Errorf("draws above zero should cost more: p5 %g vs %g", mixed.MaxRPSP5, floor.MaxRPSP5)
+	}
+}
+
+func TestMonteCarloRejectsOversizedRuns(t *testing.T) {
+	topo := Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}}
+	for _, cfg := range []MonteCarloConfig{
+		{Runs: maxMCRuns + 1},
+		{Ticks: maxMCTicks + 1},
+		{Runs: maxMCRuns, Ticks: maxMCTicks},
+	} {
+		if _, err := MonteCarlo(topo, cfg); err == nil {
+			t.Errorf("runs %d ticks %d: expected an error", cfg.Runs, cfg.Ticks)
+		}
+	}
+}
+
+func TestMonteCarloRejectsUnknownParam(t *testing.T) {
+	topo := Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}}
+	_, err := MonteCarlo(topo, MonteCarloConfig{Params: []UncertainParam{{Kind: "service", Param: "bogus"}}})
+	if err == nil {
+		t.Fatal("expected error for unknown param")
+	}
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+	"github.com/prashanth/archimedes/internal/instances"
+)
+
+// Per-node parameter keys, set from TopoBlock.Overrides or perturbed by Monte
+// Carlo runs. Profile keys replace the block's default before scaling;
+// ParamHitRatio replaces the cache hit ratio of absorbing blocks; the lock keys
+// are read by the SQL block's behavior.
+const (
+	ParamMemoryMB         = "memory_mb"
+	ParamDiskIOPS         = "disk_iops"
+	ParamNetworkMBps      = "network_mbps"
+	ParamMaxConcurrency   = "max_concurrency"
+	ParamBufferPoolRatio  = "buffer_pool_ratio"
+	ParamDefaultReadRatio = "default_read_ratio"
+	ParamFlushIntervalMs  = "flush_interval_ms"
+
+	ParamReadCPUMs       = "read_cpu_ms"
+	ParamReadMemoryMB    = "read_memory_mb"
+	ParamReadDiskIOs     = "read_disk_ios"
+	ParamReadSequential  = "read_sequential" // 1 for sequential IO, 0 for random
+	ParamReadNetworkKB   = "read_network_kb"
+	ParamWriteCPUMs      = "write_cpu_ms"
+	ParamWriteMemoryMB   = "write_memory_mb"
+	ParamWriteDiskIOs    = "write_disk_ios"
+	ParamWriteSequential = "write_sequential"
+	ParamWriteNetworkKB  = "write_network_kb"
+
+	ParamHitRatio = "hit_ratio"
+
+	ParamHotRowFraction = blocks.ParamHotRowFraction
+	ParamHotRows        = blocks.ParamHotRows
+	ParamDeadlocks      = blocks.ParamDeadlocks
+)
+
+// paramBound is the valid range of a parameter; max 0 means unbounded.
+type paramBound struct{ min, max float64 }
+
+// clamp pulls v into the bound.
+func (b paramBound) clamp(v float64) float64 {
+	v = math.Max(v, b.min)
+	if b.max > 0 {
+		v = math.Min(v, b.max)
+	}
+	return v
+}
+
+var paramBounds = map[string]paramBound{
+	ParamMemoryMB:         {1, 0},
+	ParamDiskIOPS:         {0, 0},
+	ParamNetworkMBps:      {0, 0},
+	ParamMaxConcurrency:   {1, 0},
+	ParamBufferPoolRatio:  {0, 1},
+	ParamDefaultReadRatio: {0, 1},
+	ParamFlushIntervalMs:  {1, 0},
+	ParamReadCPUMs:        {0, 0},
+	ParamReadMemoryMB:     {0, 0},
+	ParamReadDiskIOs:      {0, 0},
+	ParamReadSequential:   {0, 1},
+	ParamReadNetworkKB:    {0, 0},
+	ParamWriteCPUMs:       {0, 0},
+	ParamWriteMemoryMB:    {0, 0},
+	ParamWriteDiskIOs:     {0, 0},
+	ParamWriteSequential:  {0, 1},
+	ParamWriteNetworkKB:   {0, 0},
+	ParamHitRatio:         {0, 1},
+	ParamHotRowFraction:   {0, 1},
+	ParamHotRows:          {1, 0},
+	ParamDeadlocks:        {0, 1},
+}
+
+// checkParam reports whether v is a valid value for parameter key.
+func checkParam(key string, v float64) error {
+	b, ok := paramBounds[key]
+	if !ok {
+		keys := make([]string, 0, len(paramBounds))
+		for k := range paramBounds {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown override %q (want one of %s)", key, strings.Join(keys, ", "))
+	}
+	if math.IsNaN(v) || v < b.min || (b.max > 0 && v > b.max) {
+		if b.max > 0 {
+			return fmt.Errorf("override %s = %g outside [%g, %g]", key, v, b.min, b.max)
+		}
+		return fmt.Errorf("override %s = %g below %g", key, v, b.min)
+	}
+	return nil
+}
+
+// nodeProfile is the profile of one instance of the node: the block's
+// defaults, replaced by its instance type's hardware, then by its overrides.
+func nodeProfile(p blocks.Profile, node *Node) blocks.Profile {
+	if t, ok := instances.Get(node.Instance); ok {
+		p.CPUCores = t.VCPU
+		p.MemoryMB = t.MemoryMB
+		p.NetworkMBps = t.NetworkMBps()
+		// Blocks that never touch disk stay that way on any instance.
+		if p.DiskIOPS > 0 {
+			p.DiskIOPS = t.DiskIOPS
+		}
+	}
+	if node.Disk != nil && p.DiskIOPS > 0 {
+		p.DiskIOPS = node.Disk.iops()
+	}
+	if node.Durability != "" {
+		p.Durability = node.Durability
+	}
+	return applyOverrides(p, node)
+}
+
+// applyOverrides replaces Profile fields with the node's parameters.
+func applyOverrides(p blocks.Profile, node *Node) blocks.Profile {
+	for k, v := range node.params {
+		switch k {
+		case ParamMemoryMB:
+			p.MemoryMB = int(v)
+		case ParamDiskIOPS:
+			p.DiskIOPS = int(v)
+		case ParamNetworkMBps:
+			p.NetworkMBps = v
+		case ParamMaxConcurrency:
+			p.MaxConcurrency = int(v)
+		case ParamBufferPoolRatio:
+			p.BufferPoolRatio = v
+		case ParamDefaultReadRatio:
+			p.DefaultReadRatio = v
+		case ParamFlushIntervalMs:
+			p.FlushIntervalMs = v
+		case ParamReadCPUMs:
+			p.Read.CPUMs = v
+		case ParamReadMemoryMB:
+			p.Read.MemoryMB = v
+		case ParamReadDiskIOs:
+			p.Read.DiskIOs = v
+		case ParamReadSequential:
+			p.Read.Sequential = v >= 0.5
+		case ParamReadNetworkKB:
+			p.Read.NetworkKB = v
+		case ParamWriteCPUMs:
+			p.Write.CPUMs = v
+		case ParamWriteMemoryMB:
+			p.Write.MemoryMB = v
+		case ParamWriteDiskIOs:
+			p.Write.DiskIOs = v
+		case ParamWriteSequential:
+			p.Write.Sequential = v >= 0.5
+		case ParamWriteNetworkKB:
+			p.Write.NetworkKB = v
+		}
+	}
+	return p
+}
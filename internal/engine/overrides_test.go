@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverridesRaiseCapacity(t *testing.T) {
+	capOf := func(overrides map[string]float64) float64 {
+		g, err := BuildGraph(Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Overrides: overrides}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nodeCapacity(g.Node("db"), 0.9)
+	}
+	base := capOf(nil)
+	slow := capOf(map[string]float64{ParamDiskIOPS: 3000})
+	if slow >= base {
+		t.Errorf("3000 IOPS disk should lower capacity: %g vs %g", slow, base)
+	}
+	tuned := capOf(map[string]float64{ParamDiskIOPS: 3000, ParamBufferPoolRatio: 0.97})
+	if tuned <= slow {
+		t.Errorf("0.97 buffer pool should raise disk-bound read capacity: %g vs %g", tuned, slow)
+	}
+}
+
+func TestOverridesReachTicker(t *testing.T) {
+	memPct := func(overrides map[string]float64) float64 {
+		g, _ := BuildGraph(Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "r", Kind: "redis", Overrides: overrides}},
+			Edges:  []TopoEdge{{From: "u", To: "r"}},
+		})
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 50 {
+			results, _ = SimulateTick(g, 50000, 0.5, state)
+		}
+		return results[1].Metrics["memory_pct"]
+	}
+	small := memPct(nil)
+	big := memPct(map[string]float64{ParamMemoryMB: 65536})
+	if small <= 0 || big >= small/3 {
+		t.Errorf("64GB Redis should fill a quarter as fast as 16GB: %g vs %g", big, small)
+	}
+}
+
+func TestTopologyMixBeatsDefaultReadRatio(t *testing.T) {
+	g, _ := BuildGraph(Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "c", Kind: "cdn", Overrides: map[string]float64{ParamDefaultReadRatio: 0.5}}, {ID: "s", Kind: "service"}},
+		Edges:  []TopoEdge{{From: "u", To: "c"}, {From: "c", To: "s"}},
+	})
+	state := NewSimState(g)
+	var results []BlockResult
+	for range 300 {
+		results, _ = SimulateTick(g, 1000, 0.9, state)
+	}
+	// The CDN sees the 90% reads the user sends, not its idle default of 50%:
+	// the 100 writes/s pass through and a warm CDN absorbs most reads.
+	if rps := results[2].RPS; rps < 100 || rps > 200 {
+		t.Errorf("origin should see the writes plus read misses, got %g", rps)
+	}
+}
+
+func TestOverridesRejected(t *testing.T) {
+	for _, o := range []map[string]float64{
+		{"ram_gb": 64},
+		{ParamBufferPoolRatio: 1.5},
+		{ParamMemoryMB: 0},
+	} {
+		_, err := BuildGraph(Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Overrides: o}}})
+		if err == nil || !strings.Contains(err.Error(), `block "db"`) {
+			t.Errorf("%v: expected error naming the block, got %v", o, err)
+		}
+		if r := Validate(Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Overrides: o}}}); r.OK() {
+			t.Errorf("%v: validation should fail", o)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+const maxRecordedTicks = 100000
+
+// Control input kinds captured in a Recording.
+const (
+	InputRPS      = "rps"
+	InputTopology = "topology"
+	InputPause    = "pause"
+	InputDt       = "dt"
+)
+
+// RecordedInput is a control input applied after Tick ticks had completed.
+type RecordedInput struct {
+	Tick      int       `json:"tick"`
+	Kind      string    `json:"kind"`
+	RPS       float64   `json:"rps,omitempty"`
+	ReadRatio float64   `json:"read_ratio,omitempty"`
+	Topology  *Topology `json:"topology,omitempty"`
+	Dt        float64   `json:"dt,omitempty"`
+}
+
+// Recording is a run file: the starting state, every control input and every
+// TickResult. Replaying the inputs from Start must reproduce Results exactly.
+type Recording struct {
+	Start     *Snapshot       `json:"start"`
+	Inputs    []RecordedInput `json:"inputs,omitempty"`
+	Results   []TickResult    `json:"results"`
+	Truncated bool            `json:"truncated,omitempty"` // hit maxRecordedTicks
+}
+
+// StartRecording records from the current state, or from the next Play or
+// Restore if the simulation is not running.
+func (s *Sim) StartRecording() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec = &Recording{}
+	if s.running {
+		s.rec.Start = s.snapshotLocked()
+	}
+}
+
+// StopRecording ends recording and returns the run.
+func (s *Sim) StopRecording() (*Recording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.rec
+	s.rec = nil
+	if rec == nil || rec.Start == nil {
+		return nil, errors.New("not recording")
+	}
+	return rec, nil
+}
+
+// restartRecordingLocked begins a fresh run after Play or Restore replaced
+// the simulation. Caller must hold s.mu.
+func (s *Sim) restartRecordingLocked() {
+	if s.rec != nil {
+		s.rec = &Recording{Start: s.snapshotLocked()}
+	}
+}
+
+func (s *Sim) recordLocked(in RecordedInput) {
+	if s.rec == nil || s.rec.Start == nil || s.rec.Truncated {
+		return
+	}
+	in.Tick = s.tick
+	s.rec.Inputs = append(s.rec.Inputs, in)
+}
+
+func (s *Sim) recordResultLocked(tr TickResult) {
+	if s.rec == nil || s.rec.Start == nil || s.rec.Truncated {
+		return
+	}
+	if len(s.rec.Results) >= maxRecordedTicks {
+		s.rec.Truncated = true
+		return
+	}
+	s.rec.Results = append(s.rec.Results, tr)
+}
+
+// ReplayReport lists the ticks whose replayed results differ from the
+// recording. An empty Mismatches means the replay was bit-for-bit identical.
+type ReplayReport struct {
+	Ticks      int   `json:"ticks"`
+	Mismatches []int `json:"mismatches,omitempty"`
+}
+
+func (r *ReplayReport) OK() bool { return len(r.Mismatches) == 0 }
+
+// Replay re-runs rec's inputs from its start state through a fresh Sim and
+// compares every TickResult with the recorded one.
+func Replay(rec *Recording) (*ReplayReport, error) {
+	if rec.Start == nil {
+		return nil, errors.New("recording has no start state")
+	}
+	sim := NewSim()
+	if err := sim.Restore(rec.Start); err != nil {
+		return nil, err
+	}
+	defer sim.Stop()
+
+	report := &ReplayReport{}
+	next := 0
+	for _, want := range rec.Results {
+		report.Ticks++
+		var got TickResult
+		for got.Tick < want.Tick {
+			for next < len(rec.Inputs) && rec.Inputs[next].Tick <= sim.tick {
+				if err := sim.apply(rec.Inputs[next]); err != nil {
+					return nil, err
+				}
+				next++
+			}
+			tr, err := sim.Step(1)
+			if err != nil {
+				break
+			}
+			got = tr
+		}
+		if !sameResult(got, want) {
+			report.Mismatches = append(report.Mismatches, want.Tick)
+		}
+	}
+	return report, nil
+}
+
+func (s *Sim) apply(in RecordedInput) error {
+	switch in.Kind {
+	case InputRPS:
+		s.UpdateRPS(in.RPS, in.ReadRatio)
+	case InputTopology:
+		if in.Topology == nil {
+			return errors.New("topology input without topology")
+		}
+		return s.UpdateTopology(*in.Topology)
+	case InputPause:
+		s.Pause()
+	case InputDt:
+		return s.SetTickResolution(in.Dt)
+	default:
+		return errors.New("unknown input kind " + in.Kind)
+	}
+	return nil
+}
+
+// sameResult compares JSON encodings, which round-trip float64 exactly, so
+// equal encodings mean bit-identical results.
+func sameResult(a, b TickResult) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
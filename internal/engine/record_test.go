@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func recordSession(t *testing.T) *Recording {
+	t.Helper()
+	sim := NewSim()
+	sim.StartRecording()
+	err := sim.Play(Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "cdn", Kind: "cdn"},
+			{ID: "s", Kind: "service"},
+			{ID: "r", Kind: "redis"},
+			{ID: "db", Kind: "sql_datastore"},
+		},
+		Edges: []TopoEdge{
+			{From: "u", To: "cdn"},
+			{From: "cdn", To: "s"},
+			{From: "s", To: "r", Weight: 0.9},
+			{From: "s", To: "db", Weight: 0.3},
+		},
+		RPS:       5000,
+		ReadRatio: 0.8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+
+	sim.Step(10)
+	sim.UpdateRPS(30000, 0.5)
+	sim.Step(10)
+	sim.UpdateTopology(Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "cdn", Kind: "cdn"},
+			{ID: "s", Kind: "service", Replicas: 3},
+			{ID: "r", Kind: "redis"},
+			{ID: "db", Kind: "sql_datastore", Replicas: 2},
+		},
+		Edges: []TopoEdge{
+			{From: "u", To: "cdn"},
+			{From: "cdn", To: "s"},
+			{From: "s", To: "r", Weight: 0.9},
+			{From: "s", To: "db", Weight: 0.3},
+		},
+		RPS:       30000,
+		ReadRatio: 0.5,
+	})
+	sim.Step(10)
+	sim.Pause()
+	sim.Step(50)
+
+	rec, err := sim.StopRecording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestReplayIdentical(t *testing.T) {
+	rec := recordSession(t)
+	if len(rec.Inputs) != 3 {
+		t.Fatalf("want 3 recorded inputs, got %d", len(rec.Inputs))
+	}
+	if rec.Inputs[0].Tick != 10 || rec.Inputs[0].Kind != InputRPS {
+		t.Errorf("first input: want rps at tick 10, got %s at %d", rec.Inputs[0].Kind, rec.Inputs[0].Tick)
+	}
+
+	// Round-trip through the run file format.
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Recording
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Replay(&loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ticks != len(rec.Results) {
+		t.Errorf("replayed %d ticks, recorded %d", report.Ticks, len(rec.Results))
+	}
+	if !report.OK() {
+		t.Errorf("replay diverged at ticks %v", report.Mismatches)
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	rec := recordSession(t)
+	rec.Inputs[0].RPS = 31000
+	report, err := Replay(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Fatal("altered input should make replay diverge")
+	}
+	if report.Mismatches[0] != 11 {
+		t.Errorf("first mismatch: want tick 11, got %d", report.Mismatches[0])
+	}
+}
+
+func TestStopRecordingWithoutStart(t *testing.T) {
+	if _, err := NewSim().StopRecording(); err == nil {
+		t.Error("expected error when not recording")
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	defaultFailoverS = 30
+
+	// replayShare is the part of an instance's write throughput a replica
+	// can replay at: the primary commits on many connections, while replicas
+	// apply its log on fewer threads.
+	replayShare = 0.5
+)
+
+// Engine-owned BlockState.Extra keys for replicated nodes.
+const (
+	stateReplicationBacklog = "replication_backlog" // writes the read replicas have yet to apply
+	statePrimaryDown        = "primary_down_s"      // seconds since the primary died
+	statePromoted           = "promoted"            // 1 once a read replica took over
+)
+
+// Replication splits a block's replicas into one primary, which takes every
+// write, and read replicas, which share the reads and apply the primary's
+// writes asynchronously. When the primary dies a read replica is promoted
+// after FailoverS seconds; writes fail until then. Unset means 30s; an
+// explicit 0 fails over instantly.
+type Replication struct {
+	FailoverS *float64 `json:"failover_s,omitempty"`
+}
+
+func (r Replication) withDefaults() Replication {
+	if r.FailoverS == nil {
+		s := float64(defaultFailoverS)
+		r.FailoverS = &s
+	}
+	return r
+}
+
+func (r Replication) validate() error {
+	if r.FailoverS != nil && (math.IsNaN(*r.FailoverS) || *r.FailoverS < 0) {
+		return fmt.Errorf("replication failover_s = %g below 0", *r.FailoverS)
+	}
+	return nil
+}
+
+// replicated reports whether the node runs a primary with read replicas.
+func (n *Node) replicated() bool {
+	return n.Replication != nil && n.Replicas > 1
+}
+
+// roleCapacity is what one instance of the node sustains serving only reads
+// and only writes.
+func roleCapacity(node *Node) (reads, writes float64) {
+	one := *node
+	one.Replicas = 1
+	p := scaledProfile(&one)
+	return BlockCapacity(p, 1), BlockCapacity(p, 0)
+}
+
+// replicaUtil is the utilization of the primary and of each of n read
+// replicas at the given reads and writes per second. Every read replica
+// applies every write; without read replicas the primary serves the reads.
+func replicaUtil(node *Node, n int, reads, writes float64) (primary, replica float64) {
+	cr, cw := roleCapacity(node)
+	if n == 0 {
+		return reads/cr + writes/cw, 0
+	}
+	return writes / cw, reads/(float64(n)*cr) + writes/cw
+}
+
+// replicatedCapacity is the RPS at which the busier of the primary and the
+// read replicas saturates.
+func replicatedCapacity(node *Node, n int, readRatio float64) float64 {
+	primary, replica := replicaUtil(node, n, readRatio, 1-readRatio)
+	return 1 / max(primary, replica, 1e-12)
+}
+
+// failover tracks a dead primary and returns how many read replicas serve
+// reads and whether writes fail this tick. The dead primary loses its
+// unflushed writes; the promoted replica loses the writes it had not yet
+// applied. A revived node takes the old primary back as a read replica.
+func failover(node *Node, bs *BlockState, dt float64) (int, bool) {
+	n := node.Replicas - 1
+	if !node.Dead {
+		bs.Extra[statePrimaryDown] = 0
+		bs.Extra[statePromoted] = 0
+		return n, false
+	}
+	if bs.Extra[statePrimaryDown] == 0 {
+		loseUnflushed(bs)
+	}
+	bs.Extra[statePrimaryDown] += dt
+	if bs.Extra[statePrimaryDown] < *node.Replication.FailoverS-flushSlack {
+		return n, true
+	}
+	if bs.Extra[statePromoted] == 0 {
+		bs.Extra[statePromoted] = 1
+		bs.Extra[stateLostWrites] += bs.Extra[stateReplicationBacklog]
+		bs.Extra[stateReplicationBacklog] = 0
+	}
+	return n - 1, false
+}
+
+// replicate applies this tick's committed writes to the read replicas at
+// their replay rate, slowed by the reads they serve, so lag builds under heavy
+// writes or busy replicas. It returns the utilization of the
+// primary and of each read replica, and the replication lag in seconds.
+func replicate(node *Node, bs *BlockState, n int, done flow, dt float64) (primary, replica, lagS float64) {
+	primary, replica = replicaUtil(node, n, done.reads/dt, done.writes/dt)
+	backlog := 0.0
+	if n > 0 {
+		cr, cw := roleCapacity(node)
+		headroom := max(0, 1-done.reads/dt/(float64(n)*cr))
+		backlog = max(0, bs.Extra[stateReplicationBacklog]+done.writes-headroom*replayShare*cw*dt)
+	}
+	bs.Extra[stateReplicationBacklog] = backlog
+	// Lag is how many seconds of the primary's writes the replicas trail by.
+	return primary, replica, backlog / max(done.writes/dt, 1)
+}
+
+// failoverRemaining is how long writes keep failing on a dead primary.
+func failoverRemaining(node *Node, bs *BlockState) float64 {
+	return max(0, *node.Replication.FailoverS-bs.Extra[statePrimaryDown])
+}
+
+// replicatedHealth raises the node's bottleneck to its busiest role, since
+// the pooled profile spreads writes over replicas that never take them.
+func replicatedHealth(br *BlockResult, primary, replica float64) {
+	br.Bottleneck = max(br.Bottleneck, primary, replica)
+	br.Health = healthFor(br.Bottleneck)
+}
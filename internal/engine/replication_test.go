@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func replicatedGraph(t *testing.T, replicas int, failoverS float64) *Graph {
+	t.Helper()
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "db", Kind: "sql_datastore", Replicas: replicas, Replication: &Replication{FailoverS: &failoverS}},
+		},
+		Edges: []TopoEdge{{From: "u", To: "db"}},
+	})
+}
+
+func TestReadReplicasScaleReadsNotWrites(t *testing.T) {
+	one := replicatedGraph(t, 1, 0).Node("db")
+	db := replicatedGraph(t, 4, 0).Node("db")
+	if r1, r4 := nodeCapacity(one, 1), replicatedCapacity(db, 3, 1); math.Abs(r4/r1-3) > 1e-9 {
+		t.Errorf("3 read replicas should serve 3x the reads of one instance, got %g vs %g", r4, r1)
+	}
+	if w1, w4 := nodeCapacity(one, 0), replicatedCapacity(db, 3, 0); math.Abs(w4/w1-1) > 1e-9 {
+		t.Errorf("writes all go to the primary, got %g vs %g", w4, w1)
+	}
+	// The static model sees the busy primary even though the pool is big.
+	w1 := nodeCapacity(one, 0)
+	results, err := Simulate(replicatedGraph(t, 4, 0), 0.8*w1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1].Health != "yellow" || !approx(results[1].Bottleneck, 0.8) {
+		t.Errorf("primary at 80%% should be yellow, got %s at %g", results[1].Health, results[1].Bottleneck)
+	}
+}
+
+func TestReplicationLagGrowsWithWrites(t *testing.T) {
+	lag := func(rps float64) float64 {
+		g := replicatedGraph(t, 3, 0)
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 50 {
+			results, _ = SimulateTick(g, rps, 0.1, state)
+		}
+		return results[1].Metrics["replication_lag_s"]
+	}
+	cw := nodeCapacity(replicatedGraph(t, 1, 0).Node("db"), 0)
+	if light := lag(0.2 * cw); light != 0 {
+		t.Errorf("light writes should replicate without lag, got %gs", light)
+	}
+	// Writes past half the primary's capacity outrun the replicas' replay,
+	// long before the primary itself is busy.
+	heavy, heavier := lag(0.61*cw), lag(0.64*cw)
+	if !(heavy > 0 && heavier > heavy) {
+		t.Errorf("lag should grow with write volume, got %gs then %gs", heavy, heavier)
+	}
+}
+
+func TestPrimaryFailover(t *testing.T) {
+	g := replicatedGraph(t, 3, 2)
+	state := NewSimState(g)
+	for range 10 {
+		SimulateTick(g, 1000, 0.5, state)
+	}
+	g.Node("db").Dead = true
+	var results []BlockResult
+	for tick := 1; tick <= 30; tick++ {
+		results, _ = SimulateTick(g, 1000, 0.5, state)
+		db := results[1]
+		switch {
+		case tick < 20:
+			if db.Health != "red" || !approx(db.RPS, 500) || db.Dropped < 499 {
+				t.Fatalf("tick %d: writes should fail while reads go on, got %s rps=%g dropped=%g", tick, db.Health, db.RPS, db.Dropped)
+			}
+			if !approx(db.Metrics["failover_remaining_s"], 2-float64(tick)*0.1) {
+				t.Errorf("tick %d: failover remaining %g", tick, db.Metrics["failover_remaining_s"])
+			}
+		case tick > 20:
+			if !approx(db.RPS, 1000) || db.Dropped > 0 || db.Metrics["read_replicas"] != 1 {
+				t.Fatalf("tick %d: promoted replica should take writes with one read replica left, got %+v", tick, db)
+			}
+		}
+	}
+	g.Node("db").Dead = false
+	results, _ = SimulateTick(g, 1000, 0.5, state)
+	if results[1].Metrics["read_replicas"] != 2 {
+		t.Errorf("revived primary should rejoin as a read replica, got %g", results[1].Metrics["read_replicas"])
+	}
+}
+
+func TestStaticModelFailsOver(t *testing.T) {
+	// Past failover a dead primary's node runs as one instance fewer, as
+	// tick mode does once the promotion lands.
+	cr := nodeCapacity(replicatedGraph(t, 1, 0).Node("db"), 1)
+	g := replicatedGraph(t, 3, 2)
+	g.Node("db").Dead = true
+	results, err := Simulate(g, 0.5*cr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db := results[1]; db.Dropped != 0 || db.Health != "green" || !approx(db.Bottleneck, 0.5) {
+		t.Errorf("the one read replica left should serve the reads, got %s dropped=%g bottleneck=%g", db.Health, db.Dropped, db.Bottleneck)
+	}
+
+	state := NewSimState(g)
+	var tick []BlockResult
+	for range 40 {
+		tick, _ = SimulateTick(g, 0.5*cr, 1, state)
+	}
+	if tick[1].Dropped != 0 || tick[1].Metrics["read_replicas"] != 1 {
+		t.Errorf("tick mode should agree past failover, got %+v", tick[1])
+	}
+}
+
+func TestPromotionLosesReplicationBacklog(t *testing.T) {
+	g := replicatedGraph(t, 2, 0.1)
+	cw := nodeCapacity(replicatedGraph(t, 1, 0).Node("db"), 0)
+	state := NewSimState(g)
+	for range 20 {
+		SimulateTick(g, 0.58*cw, 0, state)
+	}
+	backlog := state.Blocks["db"].Extra[stateReplicationBacklog]
+	if backlog == 0 {
+		t.Fatal("heavy writes should leave a replication backlog")
+	}
+	g.Node("db").Dead = true
+	results, _ := SimulateTick(g, 0, 0, state)
+	if results[1].LostWrites < backlog {
+		t.Errorf("promotion should lose the %g unreplicated writes, lost %g", backlog, results[1].LostWrites)
+	}
+}
+
+func TestInstantFailover(t *testing.T) {
+	g := replicatedGraph(t, 3, 0)
+	g.Node("db").Dead = true
+	results, _ := SimulateTick(g, 1000, 0.5, NewSimState(g))
+	if db := results[1]; db.Dropped != 0 || db.Metrics["read_replicas"] != 1 {
+		t.Errorf("failover_s 0 should promote at once, got dropped=%g with %g read replicas", db.Dropped, db.Metrics["read_replicas"])
+	}
+
+	// Left out, failover takes the default 30s.
+	var r Replication
+	if err := json.Unmarshal([]byte(`{}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if got := *r.withDefaults().FailoverS; got != defaultFailoverS {
+		t.Errorf("unset failover_s should default to %ds, got %g", defaultFailoverS, got)
+	}
+	if err := json.Unmarshal([]byte(`{"failover_s": 0}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if got := *r.withDefaults().FailoverS; got != 0 {
+		t.Errorf("an explicit 0 should be kept, got %g", got)
+	}
+}
+
+func TestReplicationRejected(t *testing.T) {
+	failoverS := -1.0
+	topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Replication: &Replication{FailoverS: &failoverS}}}}
+	if _, err := BuildGraph(topo); err == nil {
+		t.Error("BuildGraph should reject a negative failover time")
+	}
+	if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_replication" {
+		t.Errorf("Validate should report bad_replication, got %+v", r.Errors)
+	}
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ShardSkew spreads a sharded block's traffic unevenly: by a Zipf law over
+// the shards, or with HotShare of it on one hot key's shard and the rest
+// spread evenly. Skewed shards are simulated as separate queues.
+type ShardSkew struct {
+	ZipfS    float64 `json:"zipf_s,omitempty"`
+	HotShare float64 `json:"hot_share,omitempty"`
+}
+
+func (s ShardSkew) validate() error {
+	if math.IsNaN(s.ZipfS) || s.ZipfS < 0 {
+		return fmt.Errorf("shard skew zipf_s = %g below 0", s.ZipfS)
+	}
+	if math.IsNaN(s.HotShare) || s.HotShare < 0 || s.HotShare > 1 {
+		return fmt.Errorf("shard skew hot_share = %g outside [0, 1]", s.HotShare)
+	}
+	if s.ZipfS > 0 && s.HotShare > 0 {
+		return fmt.Errorf("shard skew takes zipf_s or hot_share, not both")
+	}
+	return nil
+}
+
+// ShardResult is one shard's load in a tick.
+type ShardResult struct {
+	Util       float64 `json:"util"`
+	QueueDepth float64 `json:"queue_depth"`
+	Dropped    float64 `json:"dropped"`
+}
+
+// Engine-owned BlockState.Extra key prefixes for per-shard queues.
+const (
+	shardQueuePrefix      = "shard_queue:"
+	shardQueueReadsPrefix = "shard_queue_reads:"
+)
+
+// skewed reports whether the node's shards are simulated one by one. Evenly
+// loaded shards behave exactly like the pooled block, so only skew splits it.
+func (n *Node) skewed() bool {
+	return n.ShardSkew != nil && n.Shards > 1
+}
+
+// shardWeights is the share of the node's traffic each shard receives,
+// hottest first.
+func shardWeights(node *Node) []float64 {
+	w := make([]float64, node.Shards)
+	skew := node.ShardSkew
+	if skew.HotShare > 0 {
+		for i := range w {
+			w[i] = (1 - skew.HotShare) / float64(len(w))
+		}
+		w[0] += skew.HotShare
+		return w
+	}
+	var sum float64
+	for i := range w {
+		w[i] = math.Pow(float64(i+1), -skew.ZipfS)
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return w
+}
+
+// hotShardFactor is how many times the average load the hottest shard takes.
+func hotShardFactor(node *Node) float64 {
+	return shardWeights(node)[0] * float64(node.Shards)
+}
+
+// processShards runs one tick of the node's shards as separate queues, each
+// with an even share of rawCap. Fresh traffic (in less what was queued) is
+// spread by the shard weights. It returns what the shards processed and
+// dropped.
+func processShards(node *Node, bs *BlockState, in, queued flow, rawCap float64) (flow, float64, []ShardResult) {
+	w := shardWeights(node)
+	fresh := flow{in.reads - queued.reads, in.writes - queued.writes}
+	arrive := make([]flow, len(w))
+	caps := make([]float64, len(w))
+	for i := range w {
+		arrive[i] = fresh.scale(w[i])
+		caps[i] = rawCap / float64(len(w))
+	}
+	done, dropped, parts := processParts(bs, shardQueuePrefix, shardQueueReadsPrefix, queued, w, arrive, caps)
+	shards := make([]ShardResult, len(parts))
+	for i, p := range parts {
+		shards[i] = ShardResult{Util: p.util, QueueDepth: p.queue, Dropped: p.dropped}
+	}
+	return done, dropped, shards
+}
+
+// partLoad is one part's share of a tick in processParts.
+type partLoad struct{ util, processed, queue, dropped float64 }
+
+// processParts runs one tick of a node split into parts — shards or
+// replicas — each with its own queue under the given key prefixes, its own
+// capacity and a share of the queue limit in proportion to it. arrive is
+// each part's fresh traffic. A node that just split, or changed its part
+// count, spreads its queued traffic by spread instead. A part without
+// capacity is down and drops all it gets. The parts' queues add up to the
+// block's.
+func processParts(bs *BlockState, queuePrefix, readsPrefix string, queued flow, spread []float64, arrive []flow, caps []float64) (flow, float64, []partLoad) {
+	qs := make([]flow, len(arrive))
+	var sum, capSum float64
+	for i := range qs {
+		n, r := bs.Extra[queuePrefix+strconv.Itoa(i)], bs.Extra[readsPrefix+strconv.Itoa(i)]
+		qs[i] = flow{r, n - r}
+		sum += n
+		capSum += caps[i]
+	}
+	if math.Abs(sum-queued.total()) > 1e-6 {
+		for i := range qs {
+			qs[i] = queued.scale(spread[i])
+		}
+	}
+
+	var done, left flow
+	var dropped float64
+	parts := make([]partLoad, len(arrive))
+	for i := range arrive {
+		in := flow{qs[i].reads + arrive[i].reads, qs[i].writes + arrive[i].writes}
+		total := in.total()
+		if caps[i] == 0 {
+			dropped += total
+			bs.Extra[queuePrefix+strconv.Itoa(i)] = 0
+			bs.Extra[readsPrefix+strconv.Itoa(i)] = 0
+			parts[i] = partLoad{dropped: total}
+			continue
+		}
+		util := math.Min(total/caps[i], 1.0)
+		processed := math.Min(total, caps[i]*contentionFactor(util))
+		q := in.scale((total - processed) / math.Max(total, 1e-12))
+		var drop float64
+		if limit := maxQueue * caps[i] / capSum; q.total() > limit {
+			drop = q.total() - limit
+			q = q.scale(limit / q.total())
+		}
+		d := in.scale(processed / math.Max(total, 1e-12))
+		done = flow{done.reads + d.reads, done.writes + d.writes}
+		left = flow{left.reads + q.reads, left.writes + q.writes}
+		dropped += drop
+		bs.Extra[queuePrefix+strconv.Itoa(i)] = q.total()
+		bs.Extra[readsPrefix+strconv.Itoa(i)] = q.reads
+		parts[i] = partLoad{util: util, processed: processed, queue: q.total(), dropped: drop}
+	}
+	bs.Queue = left.total()
+	bs.Extra[stateQueueReads] = left.reads
+	return done, dropped, parts
+}
+
+// shardHealth raises the node's bottleneck to its hottest shard's.
+func shardHealth(br *BlockResult, shards []ShardResult) {
+	for _, s := range shards {
+		br.Bottleneck = max(br.Bottleneck, s.Util)
+	}
+	br.Health = healthFor(br.Bottleneck)
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+func shardedGraph(t *testing.T, skew *ShardSkew) *Graph {
+	t.Helper()
+	return mustGraph(t, Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "db", Kind: "sql_datastore", Shards: 4, ShardSkew: skew},
+		},
+		Edges: []TopoEdge{{From: "u", To: "db"}},
+	})
+}
+
+func runShards(t *testing.T, g *Graph, rps float64, ticks int) BlockResult {
+	t.Helper()
+	state := NewSimState(g)
+	var results []BlockResult
+	for range ticks {
+		var err error
+		if results, err = SimulateTick(g, rps, 1, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return results[1]
+}
+
+func TestEvenShardsMatchPooledBlock(t *testing.T) {
+	g := shardedGraph(t, nil)
+	rps := 1.2 * nodeCapacity(g.Node("db"), 1)
+	pooled := runShards(t, g, rps, 20)
+	even := runShards(t, shardedGraph(t, &ShardSkew{ZipfS: 0}), rps, 20)
+	// ZipfS 0 is a skew object with no skew: simulated per shard, same result.
+	if math.Abs(pooled.RPS-even.RPS) > 1e-6 || math.Abs(pooled.QueueDepth-even.QueueDepth) > 1e-6 {
+		t.Errorf("even shards should behave like the pooled block: %g/%g vs %g/%g",
+			pooled.RPS, pooled.QueueDepth, even.RPS, even.QueueDepth)
+	}
+	if len(even.Shards) != 4 || len(pooled.Shards) != 0 {
+		t.Errorf("only simulated shards are reported, got %d and %d", len(even.Shards), len(pooled.Shards))
+	}
+}
+
+func TestHotShardTurnsBlockRed(t *testing.T) {
+	// 70% of traffic on one key: its shard takes 3.1x the average.
+	g := shardedGraph(t, &ShardSkew{HotShare: 0.7})
+	rps := 0.3 * nodeCapacity(g.Node("db"), 1)
+	if even := runShards(t, shardedGraph(t, nil), rps, 1); even.Health != "green" {
+		t.Fatalf("30%% load spread evenly should be green, got %s", even.Health)
+	}
+	db := runShards(t, g, rps, 1)
+	if db.Health != "red" || db.Shards[0].Util < 0.9 || db.Shards[1].Util > 0.1 {
+		t.Errorf("the hot shard should turn the block red, got %s with shards %+v", db.Health, db.Shards)
+	}
+
+	// Overloaded, only the hot shard queues and drops.
+	db = runShards(t, g, 0.5*nodeCapacity(g.Node("db"), 1), 300)
+	if db.Shards[0].Dropped == 0 || db.Shards[1].QueueDepth > 0 {
+		t.Errorf("only the hot shard should back up, got %+v", db.Shards)
+	}
+	if db.Dropped != db.Shards[0].Dropped || db.QueueDepth != db.Shards[0].QueueDepth {
+		t.Errorf("block totals should add up the shards, got dropped=%g queue=%g", db.Dropped, db.QueueDepth)
+	}
+}
+
+func TestShardWeights(t *testing.T) {
+	g := shardedGraph(t, &ShardSkew{ZipfS: 1})
+	w := shardWeights(g.Node("db"))
+	if sum := w[0] + w[1] + w[2] + w[3]; math.Abs(sum-1) > 1e-12 || !(w[0] > w[1] && w[1] > w[2] && w[2] > w[3]) {
+		t.Errorf("zipf weights should fall off and sum to 1, got %v", w)
+	}
+	results, err := Simulate(g, 0.2*nodeCapacity(g.Node("db"), 1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hot := hotShardFactor(g.Node("db")); !approx(results[1].Bottleneck, 0.2*hot) {
+		t.Errorf("static bottleneck should be the hot shard's %g, got %g", 0.2*hot, results[1].Bottleneck)
+	}
+}
+
+func TestShardSkewRejected(t *testing.T) {
+	for _, s := range []ShardSkew{{HotShare: 1.5}, {ZipfS: -1}, {ZipfS: 1, HotShare: 0.5}} {
+		topo := Topology{Blocks: []TopoBlock{{ID: "db", Kind: "sql_datastore", Shards: 4, ShardSkew: &s}}}
+		if _, err := BuildGraph(topo); err == nil {
+			t.Errorf("%+v: BuildGraph should fail", s)
+		}
+		if r := Validate(topo); r.OK() || r.Errors[0].Code != "bad_shard_skew" {
+			t.Errorf("%+v: Validate should report bad_shard_skew, got %+v", s, r.Errors)
+		}
+	}
+}
@@ -7,35 +7,41 @@ import (
 )
 
 type BlockResult struct {
-	ID         string             `json:"id"`
-	Kind       string             `json:"kind"`
-	Name       string             `json:"name,omitempty"`
-	RPS        float64            `json:"rps"`
-	CPUUtil    float64            `json:"cpu_util"`
-	MemUtil    float64            `json:"mem_util"`
-	DiskUtil   float64            `json:"disk_util"`
-	Bottleneck float64            `json:"bottleneck"`
-	Health     string             `json:"health"`
-	QueueDepth float64            `json:"queue_depth"`
-	Dropped    float64            `json:"dropped"`
+	ID          string             `json:"id"`
+	Kind        string             `json:"kind"`
+	Name        string             `json:"name,omitempty"`
+	RPS         float64            `json:"rps"`
+	CPUUtil     float64            `json:"cpu_util"`
+	MemUtil     float64            `json:"mem_util"`
+	DiskUtil    float64            `json:"disk_util"`
+	NetUtil     float64            `json:"net_util"`
+	Bottleneck  float64            `json:"bottleneck"`
+	Health      string             `json:"health"`
+	QueueDepth  float64            `json:"queue_depth"`
+	Dropped     float64            `json:"dropped"`
 	Latency     float64            `json:"latency"`
 	PathLatency float64            `json:"path_latency"`
 	Saturated   bool               `json:"saturated"`
-	Metrics    map[string]float64 `json:"metrics,omitempty"`
+	LostWrites  float64            `json:"lost_writes,omitempty"` // acknowledged writes lost to kills, cumulative
+	Shards      []ShardResult      `json:"shards,omitempty"`      // per shard, hottest first, when the shards are skewed
+	Replicas    []ReplicaResult    `json:"replicas,omitempty"`    // per replica, when they are balanced one by one
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
 }
 
 type BlockState struct {
-	Queue float64
-	Extra map[string]float64
+	Queue float64            `json:"queue"`
+	Extra map[string]float64 `json:"extra,omitempty"`
 }
 
 type SimState struct {
 	Blocks      map[string]*BlockState
 	CurrentTick int
+	Dt          float64 // seconds per tick
+	SimTime     float64 // simulated seconds elapsed
 }
 
 func NewSimState(g *Graph) *SimState {
-	s := &SimState{Blocks: make(map[string]*BlockState, len(g.nodes))}
+	s := &SimState{Blocks: make(map[string]*BlockState, len(g.nodes)), Dt: tickDt}
 	for id, node := range g.nodes {
 		bs := &BlockState{Extra: make(map[string]float64)}
 		if b, ok := blocks.ByKind(node.Kind); ok {
@@ -43,14 +49,18 @@ func NewSimState(g *Graph) *SimState {
 				t.InitState(bs.Extra)
 			}
 		}
+		if node.bursts() {
+			bs.Extra[stateBurstCredits] = node.Disk.BurstCredits * node.volumes()
+		}
 		s.Blocks[id] = bs
 	}
 	return s
 }
 
-func (s *SimState) AllDrained() bool {
-	for _, bs := range s.Blocks {
-		if bs.Queue > 0.5 {
+// AllDrained reports whether no work is left that g could still deliver.
+func (s *SimState) AllDrained(g *Graph) bool {
+	for id, bs := range s.Blocks {
+		if bs.Queue > 0.5 || backlogged(g, g.nodes[id], bs.Extra) {
 			return false
 		}
 	}
@@ -58,8 +68,8 @@ func (s *SimState) AllDrained() bool {
 }
 
 const (
-	tickDt   = 0.1  // seconds per tick
-	maxQueue = 5000 // overflow is dropped — models client timeouts
+	tickDt   = blocks.BaseDt // default seconds per tick
+	maxQueue = 5000          // overflow is dropped — models client timeouts
 )
 
 func SimulateTick(g *Graph, rps float64, readRatio float64, state *SimState) ([]BlockResult, error) {
@@ -68,7 +78,13 @@ func SimulateTick(g *Graph, rps float64, readRatio float64, state *SimState) ([]
 		return nil, err
 	}
 
-	arriving := make(map[string]float64)
+	dt := state.Dt
+	if dt <= 0 {
+		dt = tickDt
+	}
+
+	arriving := make(map[string]flow)
+	balancing := make(map[string]map[string]flow) // the part of arriving each algorithm balances
 	pathLatency := make(map[string]float64)
 	srcs := g.Sources()
 	hasUser := false
@@ -80,116 +96,317 @@ func SimulateTick(g *Graph, rps float64, readRatio float64, state *SimState) ([]
 	}
 	for _, src := range srcs {
 		if !hasUser || src.Kind == "user" {
-			arriving[src.ID] = rps * tickDt
+			arriving[src.ID] = flow{rps * dt * readRatio, rps * dt * (1 - readRatio)}
 		}
 	}
 
 	state.CurrentTick++
+	state.SimTime += dt
 
 	results := make([]BlockResult, 0, len(order))
 	for _, id := range order {
 		node := g.nodes[id]
 		bs := state.Blocks[id]
 
-		if node.Dead {
-			dropped := (bs.Queue + arriving[id]) / tickDt
+		if node.Dead && !node.replicated() {
+			dropped := (bs.Queue + arriving[id].total()) / dt
 			bs.Queue = 0
+			bs.Extra[stateQueueReads] = 0
+			bs.Extra[stateFills] = 0
+			loseUnflushed(bs)
+			if buffered := dropWriteBehind(bs); scaledProfile(node).Durability != blocks.DurabilityNone {
+				// None-durable caches already count every write as unflushed.
+				bs.Extra[stateLostWrites] += buffered
+			}
 			results = append(results, BlockResult{
 				ID: node.ID, Kind: node.Kind, Name: node.Name,
 				Health: "red", Dropped: dropped,
 				PathLatency: pathLatency[id],
+				LostWrites:  bs.Extra[stateLostWrites],
 			})
 			continue
 		}
 
-		total := bs.Queue + arriving[id]
+		scaled := scaledProfile(node)
+		bursting := node.bursts() && scaled.DiskIOPS > 0
+		if bursting {
+			applyBurst(node, bs, &scaled, dt)
+		}
+
+		// The mix comes from what is queued and arriving. Consumers then top
+		// themselves up from their async backlogs.
+		queued := flow{bs.Extra[stateQueueReads], bs.Queue - bs.Extra[stateQueueReads]}
+		in := flow{queued.reads + arriving[id].reads, queued.writes + arriving[id].writes}
+
+		// A cache behind caching patterns also handles last tick's fills.
+		// Under cache-aside, writes skip it for the store.
+		fronts, aside := node.cachePatterns()
+		fills := bs.Extra[stateFills]
+		bs.Extra[stateFills] = 0
+		in.writes += fills
+		var bypass float64
+		if aside {
+			bypass = arriving[id].writes
+			in.writes -= bypass
+		}
+		idleRR := idleReadRatio(scaled.DefaultReadRatio, readRatio)
+		var pulled flow
+		if len(node.asyncFrom) > 0 {
+			room := consumerPullUtil*BlockCapacity(scaled, in.readRatio(idleRR))*dt - in.total()
+			pulled = pullBacklogs(g, state, node, room)
+			in = flow{in.reads + pulled.reads, in.writes + pulled.writes}
+		}
+		// A replicated node with a dead primary fails its writes until a
+		// read replica is promoted.
+		readReplicas := node.Replicas - 1
+		var failed float64
+		if node.replicated() {
+			var failing bool
+			if readReplicas, failing = failover(node, bs, dt); failing {
+				failed, in.writes = in.writes, 0
+			}
+		}
+		total := in.total()
+		blockRR := in.readRatio(idleRR)
+		baseCap := BlockCapacity(scaled, blockRR)
+		if node.replicated() {
+			baseCap = replicatedCapacity(node, readReplicas, blockRR)
+		}
 
-		blockRR := readRatio
 		var effect blocks.TickEffect
 		if b, ok := blocks.ByKind(node.Kind); ok {
-			p := b.Profile()
-			if p.DefaultReadRatio > 0 {
-				blockRR = p.DefaultReadRatio
-			}
 			if ticker, ok := b.(blocks.Ticker); ok {
 				effect = ticker.Tick(blocks.TickContext{
-					Reads:  total * blockRR,
-					Writes: total * (1 - blockRR),
-					RawCap: nodeCapacity(node, blockRR) * tickDt,
-					Dt:     tickDt,
-					State:  bs.Extra,
-					Tick:   state.CurrentTick,
+					Reads:    in.reads,
+					Writes:   in.writes,
+					RawCap:   baseCap * dt,
+					Dt:       dt,
+					State:    bs.Extra,
+					Tick:     state.CurrentTick,
+					Profile:  scaled,
+					Replicas: node.Replicas,
+					Shards:   node.Shards,
+					Params:   node.params,
 				})
 			}
 		}
 
-		rawCap := nodeCapacity(node, blockRR) * tickDt
+		rawCap := baseCap * dt
+
+		// A cache model replaces the block's own hit ratio with the steady
+		// state of its working set; an explicit hit_ratio still wins.
+		modelHit := -1.0
+		if node.CacheModel != nil {
+			modelHit = modelHitRatio(node, in.reads/dt)
+			effect.AbsorbRatio = modelHit * blockRR
+		}
+		if hr, ok := node.params[ParamHitRatio]; ok {
+			effect.AbsorbRatio = hr * blockRR
+		}
 
 		// Apply capacity modifier from block behavior.
 		if effect.CapMultiplier > 0 {
 			rawCap *= effect.CapMultiplier
 		}
 
-		// Contention: as utilization rises past 60%, effective throughput drops.
-		// Models lock waits, context switches, GC pressure in real systems.
-		util := math.Min(total/rawCap, 1.0)
-		contention := 1.0
-		if util > 0.6 {
-			t := (util - 0.6) / 0.4
-			contention = 1.0 - 0.5*t*t // quadratic — gentle at 70%, steep at 90%+
+		var processed, dropped float64
+		var done flow
+		var shards []ShardResult
+		var replicas []partLoad
+		var replicaCaps []float64
+		var rotation []bool
+		// A limit of the block's own, such as a row lock, holds work back
+		// without a busy resource's contention. Split nodes share it out as
+		// capacity.
+		limit := math.Inf(1)
+		if effect.Limit > 0 {
+			limit = effect.Limit
 		}
-		cap := rawCap * contention
-		processed := math.Min(total, cap)
-		bs.Queue = total - processed
-
-		// Drop overflow — models client timeouts / backpressure.
-		var dropped float64
-		if bs.Queue > maxQueue {
-			dropped = bs.Queue - maxQueue
-			bs.Queue = maxQueue
+		if node.skewed() {
+			done, dropped, shards = processShards(node, bs, in, queued, math.Min(rawCap, limit))
+			processed = done.total()
+		} else if node.balanced() {
+			rotation = probeReplicas(node, bs, dt)
+			done, dropped, replicas, replicaCaps = processReplicas(node, bs, in, queued, balancing[id], math.Min(rawCap, limit), rotation, state.CurrentTick)
+			processed = done.total()
+		} else {
+			// Contention: as utilization rises past 60%, effective throughput drops.
+			util := math.Min(total/rawCap, 1.0)
+			cap := math.Min(rawCap*contentionFactor(util), limit)
+			processed = math.Min(total, cap)
+			bs.Queue = total - processed
+
+			// Drop overflow — models client timeouts / backpressure.
+			if bs.Queue > maxQueue {
+				dropped = bs.Queue - maxQueue
+				bs.Queue = maxQueue
+			}
+			// Queued, processed and dropped requests all keep the mix.
+			bs.Extra[stateQueueReads] = bs.Queue * blockRR
+			done = in.scale(processed / math.Max(total, 1e-12))
 		}
-
-		effectiveRPS := processed / tickDt
-		br := computeBlock(node, effectiveRPS, blockRR)
+		// Aborted writes took their capacity but fail rather than commit.
+		aborted := done.writes * effect.AbortRatio
+		done.writes -= aborted
+		forwarded := done.absorb(effect.AbsorbRatio)
+		forwarded.writes = max(0, forwarded.writes-fills*processed/math.Max(total, 1e-12))
+
+		effectiveRPS := processed / dt
+		br := computeBlock(node, scaled, effectiveRPS, blockRR)
 		br.QueueDepth = bs.Queue
-		br.Dropped = dropped
-		br.Latency = effect.Latency
-		br.PathLatency = pathLatency[id] + effect.Latency
+		br.Dropped = dropped + aborted/dt
+		if shards != nil {
+			br.Shards = shards
+			shardHealth(&br, shards)
+		}
+		br.Latency = effect.Latency + (1-blockRR)*writeLatency(node, scaled)
+		if fronts {
+			br.Latency += patternLatency(state, node, forwarded.reads/math.Max(done.reads, 1e-12), blockRR)
+		}
+		if node.backsCache {
+			bs.Extra[stateStoreLatency] = br.Latency
+		}
+		br.PathLatency = pathLatency[id] + br.Latency
 		br.Saturated = effect.Saturated
 		br.Metrics = effect.Metrics
+		if replicas != nil {
+			br.Replicas = replicaResults(node, replicas, replicaCaps, rotation, br.Latency, dt)
+			replicaHealth(&br, node, br.Replicas)
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["replica_imbalance"], br.Metrics["tail_latency_ms"] = replicaSpread(br.Replicas, replicas)
+			if node.healthCheck != nil {
+				window, lost := trackDetection(node, bs, br.Replicas, replicas, dt)
+				br.Metrics["detection_window_s"] = window
+				br.Metrics["detection_lost"] = lost
+				br.Metrics["in_rotation"] = float64(countTrue(rotation))
+			}
+			for _, r := range br.Replicas {
+				if r.Down && r.Dropped > 0 {
+					// A down replica still in rotation black-holes its share.
+					br.Health = "red"
+				}
+			}
+		}
+		br.LostWrites = bs.Extra[stateLostWrites]
 		if mp, ok := effect.Metrics["mem_pressure"]; ok {
 			br.MemUtil = mp
 		}
+		if node.replicated() {
+			primary, replica, lag := replicate(node, bs, readReplicas, done, dt)
+			replicatedHealth(&br, primary, replica)
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["read_replicas"] = float64(readReplicas)
+			br.Metrics["primary_util"] = primary
+			br.Metrics["replica_util"] = replica
+			br.Metrics["replication_lag_s"] = lag
+			if node.Dead {
+				br.Metrics["failover_remaining_s"] = failoverRemaining(node, bs)
+			}
+			if failed > 0 {
+				br.Dropped += failed / dt
+				br.Health = "red"
+			}
+		}
+		if modelHit >= 0 {
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["hit_ratio"] = modelHit
+		}
+		if at := trackUnflushed(bs, scaled, done.writes, dt); at > 0 {
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["unflushed_writes"] = at
+		}
+		if len(node.asyncFrom) > 0 {
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["consumer_lag"], br.Metrics["consumer_lag_s"] = consumerLag(state, node, pulled.total(), dt)
+		}
+		if bursting {
+			if br.Metrics == nil {
+				br.Metrics = make(map[string]float64)
+			}
+			br.Metrics["disk_iops_limit"] = float64(scaled.DiskIOPS)
+			br.Metrics["burst_balance"] = spendBurst(node, bs, scaled, effectiveRPS, blockRR, dt)
+		}
 		results = append(results, br)
 
-		forwarded := processed * (1 - effect.AbsorbRatio)
 		for _, oe := range node.outgoing {
-			arriving[oe.To] += forwarded * oe.Weight * oe.Multiplier
+			out := forwarded.along(oe)
+			// Async traffic waits in this block's backlog and carries no
+			// latency onward: the producer is acknowledged once it is queued.
+			if oe.Async {
+				bs.Extra[backlogKey(oe.To)] += out.total()
+				bs.Extra[backlogReadsKey(oe.To)] += out.reads
+				continue
+			}
+			if oe.Cache != "" {
+				// Misses come back as fills; write-behind holds writes for
+				// the next flush; cache-aside writes bypassed the cache for
+				// this store alone. The cache's latency already includes the
+				// store's, so the path does not run on through it.
+				bs.Extra[stateFills] += out.reads
+				if oe.Cache == CacheAside {
+					out.writes += flow{0, bypass}.along(oe).writes
+				}
+				if oe.Cache == WriteBehind {
+					bs.Extra[writeBehindKey(oe.To)] += out.writes
+					out.writes = 0
+				}
+				arriving[oe.To] = flow{arriving[oe.To].reads + out.reads, arriving[oe.To].writes + out.writes}
+				addBalanced(balancing, oe, out)
+				continue
+			}
+			arriving[oe.To] = flow{arriving[oe.To].reads + out.reads, arriving[oe.To].writes + out.writes}
+			addBalanced(balancing, oe, out)
 			if candidate := br.PathLatency + oe.LatencyMs; candidate > pathLatency[oe.To] {
 				pathLatency[oe.To] = candidate
 			}
 		}
+		if fronts {
+			flushWriteBehind(node, bs, scaled, arriving, balancing, dt)
+		}
 	}
 	return results, nil
 }
 
 func nodeCapacity(node *Node, readRatio float64) float64 {
+	return BlockCapacity(scaledProfile(node), readRatio)
+}
+
+// scaledProfile is the node's ScaleProfile, or an empty profile (unlimited,
+// always green) for users and unknown kinds.
+func scaledProfile(node *Node) blocks.Profile {
 	b, ok := blocks.ByKind(node.Kind)
 	if !ok || node.Kind == "user" {
-		return math.MaxFloat64
+		return blocks.Profile{}
 	}
-	return BlockCapacity(ScaleProfile(b.Profile(), node), readRatio)
+	return ScaleProfile(b.Profile(), node)
 }
 
-// ScaleProfile adjusts a block's hardware profile based on replicas, shards,
-// and CPU override. Replicas scale CPU, memory, and concurrency linearly.
+// ScaleProfile adjusts a block's hardware profile based on its instance type,
+// per-node overrides, replicas, shards, and CPU override. Replicas scale CPU,
+// memory, network, and concurrency linearly.
 // Shards scale disk I/O and concurrency (parallel partitions).
 func ScaleProfile(p blocks.Profile, node *Node) blocks.Profile {
+	p = nodeProfile(p, node)
+	if p.DiskIOPS > 0 {
+		// Group commits take their share of each instance's disk first.
+		p.DiskIOPS = max(p.DiskIOPS-int(math.Ceil(flushIOPS(p))), 1)
+	}
 	if node.CPUCores > 0 {
 		p.CPUCores = node.CPUCores
 	}
 	p.CPUCores *= node.Replicas
 	p.MemoryMB *= node.Replicas
+	p.NetworkMBps *= float64(node.Replicas)
 	p.MaxConcurrency *= node.Replicas * node.Shards
 	p.DiskIOPS *= node.Replicas * node.Shards
 	return p
@@ -207,28 +424,19 @@ func BlockCapacity(p blocks.Profile, readRatio float64) float64 {
 		cap = math.Min(cap, float64(p.CPUCores)*1000/weightedCPUMs)
 	}
 
-	// Disk: reads benefit from buffer pool, writes don't.
-	// Sequential IO is 10x more efficient (counts as 1/10th of an IOPS).
+	// Disk: see diskIOsPerRequest.
 	if p.DiskIOPS > 0 {
-		var weightedDiskIOs float64
-
-		readIOs := p.Read.DiskIOs * (1 - p.BufferPoolRatio) * readRatio
-		if p.Read.Sequential {
-			readIOs /= 10
-		}
-		weightedDiskIOs += readIOs
-
-		writeIOs := p.Write.DiskIOs * writeRatio
-		if p.Write.Sequential {
-			writeIOs /= 10
-		}
-		weightedDiskIOs += writeIOs
-
-		if weightedDiskIOs > 0 {
+		if weightedDiskIOs := diskIOsPerRequest(p, readRatio); weightedDiskIOs > 0 {
 			cap = math.Min(cap, float64(p.DiskIOPS)/weightedDiskIOs)
 		}
 	}
 
+	// Network: bytes per request against the NIC's bandwidth.
+	weightedNetKB := p.Read.NetworkKB*readRatio + p.Write.NetworkKB*writeRatio
+	if p.NetworkMBps > 0 && weightedNetKB > 0 {
+		cap = math.Min(cap, p.NetworkMBps*1000/weightedNetKB)
+	}
+
 	return cap
 }
 
@@ -238,7 +446,8 @@ func Simulate(g *Graph, rps float64, readRatio float64) ([]BlockResult, error) {
 		return nil, err
 	}
 
-	incoming := make(map[string]float64)
+	incoming := make(map[string]flow)
+	balancing := make(map[string]map[string]flow)
 	pathLatency := make(map[string]float64)
 	srcs := g.Sources()
 	hasUser := false
@@ -250,15 +459,24 @@ func Simulate(g *Graph, rps float64, readRatio float64) ([]BlockResult, error) {
 	}
 	for _, src := range srcs {
 		if !hasUser || src.Kind == "user" {
-			incoming[src.ID] = rps
+			incoming[src.ID] = flow{rps * readRatio, rps * (1 - readRatio)}
 		}
 	}
 
 	results := make([]BlockResult, 0, len(order))
 	for _, id := range order {
 		node := g.nodes[id]
-		nodeRPS := incoming[id]
-
+		in := incoming[id]
+		nodeRPS := in.total()
+
+		if node.Dead && node.replicated() {
+			// Steady state is past failover: a read replica has been
+			// promoted and the rest keep serving reads.
+			promoted := *node
+			promoted.Replicas--
+			promoted.Dead = false
+			node = &promoted
+		}
 		if node.Dead {
 			results = append(results, BlockResult{
 				ID: node.ID, Kind: node.Kind, Name: node.Name,
@@ -268,12 +486,70 @@ func Simulate(g *Graph, rps float64, readRatio float64) ([]BlockResult, error) {
 			continue
 		}
 
-		br := computeBlock(node, nodeRPS, readRatio)
+		miss := 1.0
+		if hr, ok := node.params[ParamHitRatio]; ok {
+			miss = 1 - hr
+		} else if node.CacheModel != nil {
+			miss = 1 - modelHitRatio(node, in.reads)
+		}
+		// A cache behind caching patterns also writes its misses back in as
+		// fills; under cache-aside, writes skip it for the store. Write-behind
+		// batches reach the store at the same average rate as write-through.
+		served := in
+		if fronts, aside := node.cachePatterns(); fronts {
+			if aside {
+				served.writes = 0
+			}
+			for _, oe := range node.outgoing {
+				if oe.Cache != "" {
+					served.writes += flow{in.reads * miss, 0}.along(oe).reads
+				}
+			}
+		}
+
+		p := scaledProfile(node)
+		br := computeBlock(node, p, served.total(), served.readRatio(idleReadRatio(p.DefaultReadRatio, readRatio)))
+		if node.replicated() {
+			primary, replica := replicaUtil(node, node.Replicas-1, in.reads, in.writes)
+			replicatedHealth(&br, primary, replica)
+		}
+		if node.skewed() {
+			// The hottest shard runs hotter than the average by its weight.
+			br.Bottleneck *= hotShardFactor(node)
+			br.Health = healthFor(br.Bottleneck)
+		}
+		var lost flow
+		if node.balanced() {
+			var hot float64
+			hot, lost = staticReplicas(node, balancing[id], in)
+			br.Bottleneck *= hot
+			br.Health = healthFor(br.Bottleneck)
+			if lost.total() > 0 {
+				br.Dropped = lost.total()
+				br.Health = "red"
+			}
+		}
 		br.PathLatency = pathLatency[id] + br.Latency
 		results = append(results, br)
 
+		forwarded := flow{(in.reads - lost.reads) * miss, in.writes - lost.writes}
+		// Under cache-aside, writes skip the cache for its store alone.
+		var bypass float64
+		if _, aside := node.cachePatterns(); aside {
+			bypass, forwarded.writes = forwarded.writes, 0
+		}
 		for _, oe := range node.outgoing {
-			incoming[oe.To] += nodeRPS * oe.Weight * oe.Multiplier
+			out := forwarded.along(oe)
+			if oe.Cache == CacheAside {
+				out.writes += flow{0, bypass}.along(oe).writes
+			}
+			incoming[oe.To] = flow{incoming[oe.To].reads + out.reads, incoming[oe.To].writes + out.writes}
+			addBalanced(balancing, oe, out)
+			// Consumers take the average load off an async edge, but the
+			// producer's path ends at the queue.
+			if oe.Async {
+				continue
+			}
 			if candidate := br.PathLatency + oe.LatencyMs; candidate > pathLatency[oe.To] {
 				pathLatency[oe.To] = candidate
 			}
@@ -282,16 +558,25 @@ func Simulate(g *Graph, rps float64, readRatio float64) ([]BlockResult, error) {
 	return results, nil
 }
 
-func computeBlock(node *Node, rps float64, readRatio float64) BlockResult {
-	br := BlockResult{ID: node.ID, Kind: node.Kind, Name: node.Name, RPS: rps}
-
-	b, ok := blocks.ByKind(node.Kind)
-	if !ok || node.Kind == "user" {
-		br.Health = "green"
-		return br
+// diskIOsPerRequest is the disk IOs one request costs at the given mix.
+// Reads benefit from the buffer pool, writes don't. Sequential IO is 10x more
+// efficient (counts as 1/10th of an IOPS); a per-write fsync is not.
+func diskIOsPerRequest(p blocks.Profile, readRatio float64) float64 {
+	readIOs := p.Read.DiskIOs * (1 - p.BufferPoolRatio) * readRatio
+	if p.Read.Sequential {
+		readIOs /= 10
 	}
+	writeIOs := p.Write.DiskIOs
+	if p.Write.Sequential {
+		writeIOs /= 10
+	}
+	return readIOs + (writeIOs+fsyncIOs(p))*(1-readRatio)
+}
+
+// computeBlock derives utilization and health from the node's scaled profile p.
+func computeBlock(node *Node, p blocks.Profile, rps float64, readRatio float64) BlockResult {
+	br := BlockResult{ID: node.ID, Kind: node.Kind, Name: node.Name, RPS: rps}
 
-	p := ScaleProfile(b.Profile(), node)
 	writeRatio := 1.0 - readRatio
 	readRPS := rps * readRatio
 	writeRPS := rps * writeRatio
@@ -310,39 +595,39 @@ func computeBlock(node *Node, rps float64, readRatio float64) BlockResult {
 		br.MemUtil = concurrent * weightedMemMB / float64(p.MemoryMB)
 	}
 
-	// Disk utilization: reads benefit from buffer pool, writes don't.
-	// Sequential IO is 10x more efficient.
+	// Disk utilization: IOs per second against the disk's IOPS.
 	if p.DiskIOPS > 0 {
-		var diskIOsPerSec float64
+		br.DiskUtil = rps * diskIOsPerRequest(p, readRatio) / float64(p.DiskIOPS)
+	}
 
-		if p.Read.DiskIOs > 0 {
-			readIOs := readRPS * p.Read.DiskIOs * (1 - p.BufferPoolRatio)
-			if p.Read.Sequential {
-				readIOs /= 10
-			}
-			diskIOsPerSec += readIOs
-		}
+	if p.NetworkMBps > 0 {
+		br.NetUtil = (readRPS*p.Read.NetworkKB + writeRPS*p.Write.NetworkKB) / 1000 / p.NetworkMBps
+	}
 
-		if p.Write.DiskIOs > 0 {
-			writeIOs := writeRPS * p.Write.DiskIOs
-			if p.Write.Sequential {
-				writeIOs /= 10
-			}
-			diskIOsPerSec += writeIOs
-		}
+	br.Bottleneck = max(br.CPUUtil, br.MemUtil, br.DiskUtil, br.NetUtil)
+	br.Health = healthFor(br.Bottleneck)
+	return br
+}
 
-		br.DiskUtil = diskIOsPerSec / float64(p.DiskIOPS)
+// contentionFactor is the share of capacity left at a utilization: past 60%
+// effective throughput drops, quadratic — gentle at 70%, steep at 90%+.
+// Models lock waits, context switches, GC pressure in real systems.
+func contentionFactor(util float64) float64 {
+	if util <= 0.6 {
+		return 1.0
 	}
+	t := (util - 0.6) / 0.4
+	return 1.0 - 0.5*t*t
+}
 
-	br.Bottleneck = max(br.CPUUtil, br.MemUtil, br.DiskUtil)
-
+// healthFor maps a bottleneck utilization to green, yellow or red.
+func healthFor(bottleneck float64) string {
 	switch {
-	case br.Bottleneck < 0.6:
-		br.Health = "green"
-	case br.Bottleneck < 0.9:
-		br.Health = "yellow"
+	case bottleneck < 0.6:
+		return "green"
+	case bottleneck < 0.9:
+		return "yellow"
 	default:
-		br.Health = "red"
+		return "red"
 	}
-	return br
 }
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Snapshot is the full state of a running simulation: the topology, load
+// settings, tick counter and every block's queue and Ticker state. It
+// round-trips through JSON so a moment can be bookmarked and replayed.
+type Snapshot struct {
+	Topology  Topology               `json:"topology"`
+	RPS       float64                `json:"rps"`
+	ReadRatio float64                `json:"read_ratio"`
+	Paused    bool                   `json:"paused,omitempty"`
+	Tick      int                    `json:"tick"`
+	Dt        float64                `json:"dt"`
+	SimTime   float64                `json:"sim_time"`
+	Blocks    map[string]*BlockState `json:"blocks"`
+}
+
+// Snapshot captures the current simulation state.
+func (s *Sim) Snapshot() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return nil, ErrNotRunning
+	}
+	return s.snapshotLocked(), nil
+}
+
+func (s *Sim) snapshotLocked() *Snapshot {
+	snap := &Snapshot{
+		Topology:  s.topo,
+		RPS:       s.rps,
+		ReadRatio: s.readRatio,
+		Paused:    s.paused,
+		Tick:      s.tick,
+		Dt:        s.state.Dt,
+		SimTime:   s.state.SimTime,
+		Blocks:    make(map[string]*BlockState, len(s.state.Blocks)),
+	}
+	for id, bs := range s.state.Blocks {
+		snap.Blocks[id] = &BlockState{Queue: bs.Queue, Extra: maps.Clone(bs.Extra)}
+	}
+	return snap
+}
+
+// Restore replaces the simulation with snap, running or not. The restored
+// simulation starts frozen so it can be reconfigured before Resume or Step.
+func (s *Sim) Restore(snap *Snapshot) error {
+	g, err := BuildGraph(snap.Topology)
+	if err != nil {
+		return err
+	}
+	state, err := snap.state(g)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.stopLocked()
+	}
+	s.graph = g
+	s.topo = snap.Topology
+	s.rps = snap.RPS
+	s.readRatio = snap.ReadRatio
+	s.paused = snap.Paused
+	s.tick = snap.Tick
+	s.dt = state.Dt
+	s.state = state
+	s.running = true
+	s.frozen = true
+	s.restartRecordingLocked()
+	return nil
+}
+
+// state rebuilds a SimState for g from the snapshot. Blocks absent from the
+// snapshot start fresh; snapshot blocks absent from g are an error.
+func (snap *Snapshot) state(g *Graph) (*SimState, error) {
+	state := NewSimState(g)
+	for id, bs := range snap.Blocks {
+		nbs, ok := state.Blocks[id]
+		if !ok {
+			return nil, fmt.Errorf("snapshot block %q not in topology", id)
+		}
+		nbs.Queue = bs.Queue
+		maps.Copy(nbs.Extra, bs.Extra)
+	}
+	pruneBacklogs(g, state)
+	if snap.Dt > 0 {
+		if snap.Dt < minTickDt || snap.Dt > maxTickDt {
+			return nil, fmt.Errorf("snapshot tick resolution %gs outside [%g, %g]", snap.Dt, minTickDt, maxTickDt)
+		}
+		state.Dt = snap.Dt
+	}
+	state.SimTime = snap.SimTime
+	state.CurrentTick = snap.Tick
+	return state, nil
+}
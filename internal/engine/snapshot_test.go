@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	topo := Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "s", Kind: "service"},
+			{ID: "r", Kind: "redis"},
+		},
+		Edges:     []TopoEdge{{From: "u", To: "s"}, {From: "s", To: "r"}},
+		RPS:       25000,
+		ReadRatio: 0.5,
+	}
+	sim := NewSim()
+	if err := sim.Play(topo); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+	if _, err := sim.Step(10); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := sim.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// Advance the original and a restored copy by the same ticks:
+	// they should produce identical results.
+	want, _ := sim.Step(5)
+
+	other := NewSim()
+	if err := other.Restore(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	got, err := other.Step(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tick != want.Tick {
+		t.Errorf("tick: want %d, got %d", want.Tick, got.Tick)
+	}
+	for i := range want.Blocks {
+		w, g := want.Blocks[i], got.Blocks[i]
+		if w.ID != g.ID || w.QueueDepth != g.QueueDepth || w.RPS != g.RPS {
+			t.Errorf("block %s diverged: want rps=%g queue=%g, got rps=%g queue=%g",
+				w.ID, w.RPS, w.QueueDepth, g.RPS, g.QueueDepth)
+		}
+	}
+}
+
+func TestRestoreRejectsUnknownBlock(t *testing.T) {
+	snap := &Snapshot{
+		Topology: Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}},
+		Blocks:   map[string]*BlockState{"ghost": {Queue: 10}},
+	}
+	if err := NewSim().Restore(snap); err == nil {
+		t.Fatal("expected error for snapshot block missing from topology")
+	}
+}
+
+func TestSnapshotRequiresRunningSim(t *testing.T) {
+	if _, err := NewSim().Snapshot(); err != ErrNotRunning {
+		t.Errorf("want ErrNotRunning, got %v", err)
+	}
+}
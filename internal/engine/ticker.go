@@ -1,31 +1,110 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 )
 
+const (
+	minTickDt = 0.001 // 1ms
+	maxTickDt = 60.0
+	maxSpeed  = 1000.0
+	maxStep   = 10000 // ticks per Step call
+)
+
+var ErrNotRunning = errors.New("simulation is not running")
+
+// MaxSpeed is the speed that runs ticks back to back with no wall-clock
+// delay: +Inf, which SetSpeed accepts alongside the finite range.
+func MaxSpeed() float64 { return math.Inf(1) }
+
 type TickResult struct {
-	Tick   int           `json:"tick"`
-	Blocks []BlockResult `json:"blocks"`
-	Done   bool          `json:"done,omitempty"`
+	Tick    int           `json:"tick"`
+	SimTime float64       `json:"sim_time"` // simulated seconds elapsed
+	Blocks  []BlockResult `json:"blocks"`
+	Done    bool          `json:"done,omitempty"`
 }
 
 type Sim struct {
 	mu        sync.Mutex
 	graph     *Graph
+	topo      Topology // source of graph, kept for snapshots
 	rps       float64
 	readRatio float64
 	tick      int
 	stop      chan struct{}
 	running   bool
-	paused    bool
+	paused    bool // draining at zero RPS until queues empty
+	frozen    bool // state held, tick loop not running
 	state     *SimState
 	subs      []chan TickResult
+	speed     float64 // simulated seconds per wall-clock second; MaxSpeed runs flat out
+	dt        float64 // simulated seconds per tick
+	rec       *Recording
 }
 
 func NewSim() *Sim {
-	return &Sim{}
+	return &Sim{speed: 1, dt: tickDt}
+}
+
+// CheckSpeed reports whether SetSpeed would accept speed.
+func CheckSpeed(speed float64) error {
+	if math.IsInf(speed, 1) {
+		return nil
+	}
+	if !(speed > 0 && speed <= maxSpeed) {
+		return fmt.Errorf("speed %g outside (0, %g]", speed, maxSpeed)
+	}
+	return nil
+}
+
+// CheckTickResolution reports whether SetTickResolution would accept dt.
+func CheckTickResolution(dt float64) error {
+	if !(dt >= minTickDt && dt <= maxTickDt) {
+		return fmt.Errorf("tick resolution %gs outside [%g, %g]", dt, minTickDt, maxTickDt)
+	}
+	return nil
+}
+
+// SetSpeed changes how fast simulated time runs relative to wall-clock time:
+// 1 is real time and 10 is ten times faster, up to 1000x; MaxSpeed runs
+// ticks as fast as possible. It takes effect from the next tick.
+func (s *Sim) SetSpeed(speed float64) error {
+	if err := CheckSpeed(speed); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speed = speed
+	return nil
+}
+
+// SetTickResolution changes the simulated seconds covered by each tick.
+func (s *Sim) SetTickResolution(dt float64) error {
+	if err := CheckTickResolution(dt); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dt = dt
+	if s.state != nil {
+		s.state.Dt = dt
+	}
+	if s.running {
+		s.recordLocked(RecordedInput{Kind: InputDt, Dt: dt})
+	}
+	return nil
+}
+
+// interval is the wall-clock delay between ticks. Caller must hold s.mu.
+func (s *Sim) interval() time.Duration {
+	if math.IsInf(s.speed, 1) {
+		return 0
+	}
+	return time.Duration(s.dt / s.speed * float64(time.Second))
 }
 
 func (s *Sim) Subscribe() chan TickResult {
@@ -48,7 +127,12 @@ func (s *Sim) Unsubscribe(ch chan TickResult) {
 	}
 }
 
+// Play starts a fresh simulation of topo. A topology with validation errors
+// is rejected with a *ValidationError; warnings do not stop it.
 func (s *Sim) Play(topo Topology) error {
+	if report := Validate(topo); !report.OK() {
+		return &ValidationError{Report: report}
+	}
 	g, err := BuildGraph(topo)
 	if err != nil {
 		return err
@@ -62,6 +146,7 @@ func (s *Sim) Play(topo Topology) error {
 	}
 
 	s.graph = g
+	s.topo = topo
 	s.rps = topo.RPS
 	s.readRatio = topo.ReadRatio
 	s.tick = 0
@@ -69,8 +154,10 @@ func (s *Sim) Play(topo Topology) error {
 	s.running = true
 	s.paused = false
 	s.state = NewSimState(g)
+	s.state.Dt = s.dt
+	s.restartRecordingLocked()
 
-	go s.loop()
+	go s.loop(s.stop, s.interval())
 	return nil
 }
 
@@ -80,12 +167,88 @@ func (s *Sim) Pause() {
 	if s.running && !s.paused {
 		s.rps = 0
 		s.paused = true
+		s.recordLocked(RecordedInput{Kind: InputPause})
+	}
+}
+
+// Freeze halts the tick loop without touching load or state, so the
+// simulation can be inspected or advanced with Step.
+func (s *Sim) Freeze() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return ErrNotRunning
 	}
+	if !s.frozen {
+		close(s.stop)
+		s.frozen = true
+	}
+	return nil
+}
+
+// Resume restarts the tick loop after Freeze or Step.
+func (s *Sim) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return ErrNotRunning
+	}
+	if s.frozen {
+		s.frozen = false
+		s.stop = make(chan struct{})
+		go s.loop(s.stop, s.interval())
+	}
+	return nil
+}
+
+// Step freezes the simulation and advances it by n ticks, publishing each
+// TickResult to subscribers. It returns the last result.
+func (s *Sim) Step(n int) (TickResult, error) {
+	if n < 1 || n > maxStep {
+		return TickResult{}, fmt.Errorf("step count %d outside [1, %d]", n, maxStep)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return TickResult{}, ErrNotRunning
+	}
+	if !s.frozen {
+		close(s.stop)
+		s.frozen = true
+	}
+
+	var tr TickResult
+	for range n {
+		var err error
+		tr, err = s.stepLocked()
+		if err != nil {
+			return TickResult{}, err
+		}
+		if tr.Done {
+			s.stopLocked()
+			break
+		}
+	}
+	return tr, nil
+}
+
+// Stop ends the simulation and tells subscribers it is done.
+func (s *Sim) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return
+	}
+	s.stopLocked()
+	s.broadcast(TickResult{Tick: s.tick, SimTime: s.state.SimTime, Done: true})
 }
 
 func (s *Sim) stopLocked() {
-	close(s.stop)
+	if !s.frozen {
+		close(s.stop)
+	}
 	s.running = false
+	s.frozen = false
 }
 
 func (s *Sim) UpdateRPS(rps float64, readRatio float64) {
@@ -93,6 +256,9 @@ func (s *Sim) UpdateRPS(rps float64, readRatio float64) {
 	defer s.mu.Unlock()
 	s.rps = rps
 	s.readRatio = readRatio
+	if s.running {
+		s.recordLocked(RecordedInput{Kind: InputRPS, RPS: rps, ReadRatio: readRatio})
+	}
 }
 
 func (s *Sim) UpdateTopology(topo Topology) error {
@@ -108,7 +274,11 @@ func (s *Sim) UpdateTopology(topo Topology) error {
 
 	old := s.state
 	s.graph = g
+	s.topo = topo
 	s.state = NewSimState(g)
+	s.state.Dt = old.Dt
+	s.state.SimTime = old.SimTime
+	s.state.CurrentTick = old.CurrentTick
 	for id, bs := range old.Blocks {
 		if nbs, ok := s.state.Blocks[id]; ok {
 			nbs.Queue = bs.Queue
@@ -117,46 +287,72 @@ func (s *Sim) UpdateTopology(topo Topology) error {
 			}
 		}
 	}
+	pruneBacklogs(g, s.state)
 	s.rps = topo.RPS
 	s.readRatio = topo.ReadRatio
+	s.recordLocked(RecordedInput{Kind: InputTopology, Topology: &topo})
 	return nil
 }
 
+// broadcast delivers tr to every subscriber. A slow subscriber's stale
+// result is replaced so it always sees the latest tick, including Done.
 func (s *Sim) broadcast(tr TickResult) {
 	for _, ch := range s.subs {
 		select {
 		case ch <- tr:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
 		default:
 		}
+		select {
+		case ch <- tr:
+		default:
+		}
+	}
+}
+
+// stepLocked advances one tick and broadcasts the result. Caller must hold s.mu.
+func (s *Sim) stepLocked() (TickResult, error) {
+	results, err := SimulateTick(s.graph, s.rps, s.readRatio, s.state)
+	if err != nil {
+		return TickResult{}, err
 	}
+	s.tick++
+	done := s.paused && s.state.AllDrained(s.graph)
+	tr := TickResult{Tick: s.tick, SimTime: s.state.SimTime, Blocks: results, Done: done}
+	s.broadcast(tr)
+	s.recordResultLocked(tr)
+	return tr, nil
 }
 
-func (s *Sim) loop() {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+func (s *Sim) loop(stop chan struct{}, first time.Duration) {
+	timer := time.NewTimer(first)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-s.stop:
+		case <-stop:
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			s.mu.Lock()
-			s.tick++
-			results, err := SimulateTick(s.graph, s.rps, s.readRatio, s.state)
-			if err != nil {
+			// Freeze or Play may have won the lock while the timer fired.
+			select {
+			case <-stop:
 				s.mu.Unlock()
-				continue
+				return
+			default:
 			}
 
-			done := s.paused && s.state.AllDrained()
-			tr := TickResult{Tick: s.tick, Blocks: results, Done: done}
-			s.broadcast(tr)
-
-			if done {
+			tr, err := s.stepLocked()
+			if err == nil && tr.Done {
 				s.stopLocked()
 				s.mu.Unlock()
 				return
 			}
+			timer.Reset(s.interval())
 			s.mu.Unlock()
 		}
 	}
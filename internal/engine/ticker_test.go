@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSimTimeAdvancesByDt(t *testing.T) {
+	g := mustGraph(t, Topology{
+		Blocks: []TopoBlock{{ID: "s", Kind: "service"}},
+	})
+	state := NewSimState(g)
+	state.Dt = 0.5
+	for range 4 {
+		SimulateTick(g, 100, 1.0, state)
+	}
+	if !approx(state.SimTime, 2.0) {
+		t.Errorf("sim time: want 2.0s, got %g", state.SimTime)
+	}
+}
+
+func TestTickResolutionPreservesDynamics(t *testing.T) {
+	// CDN warm-up should depend on simulated seconds, not tick count:
+	// 5s at 100ms ticks and 5s at 1s ticks reach the same hit ratio.
+	topo := Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "cdn", Kind: "cdn"}},
+		Edges:  []TopoEdge{{From: "u", To: "cdn"}},
+	}
+	fine := NewSimState(mustGraph(t, topo))
+	g := mustGraph(t, topo)
+	for range 50 {
+		SimulateTick(g, 1000, 0.9, fine)
+	}
+	coarse := NewSimState(g)
+	coarse.Dt = 1.0
+	for range 5 {
+		SimulateTick(g, 1000, 0.9, coarse)
+	}
+	a := fine.Blocks["cdn"].Extra["hit_ratio"]
+	b := coarse.Blocks["cdn"].Extra["hit_ratio"]
+	if math.Abs(a-b) > 0.01 {
+		t.Errorf("hit ratio should match across resolutions: 100ms=%g 1s=%g", a, b)
+	}
+}
+
+func TestSimMaxSpeed(t *testing.T) {
+	// At max speed the loop runs ticks back to back, covering far more
+	// than real-time ticks.
+	sim := NewSim()
+	if err := sim.SetSpeed(MaxSpeed()); err != nil {
+		t.Fatal(err)
+	}
+	if d := sim.interval(); d != 0 {
+		t.Errorf("max speed should not wait between ticks, got %v", d)
+	}
+	ch := sim.Subscribe()
+	defer sim.Unsubscribe(ch)
+	if err := sim.Play(Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}, RPS: 100}); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Pause()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case tr := <-ch:
+			if tr.Tick >= 100 {
+				if !approx(tr.SimTime, float64(tr.Tick)*tickDt) {
+					t.Errorf("sim time: want %g, got %g", float64(tr.Tick)*tickDt, tr.SimTime)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("max speed did not reach 100 ticks in 2s")
+		}
+	}
+}
+
+func TestSetSpeedBounds(t *testing.T) {
+	sim := NewSim()
+	for _, speed := range []float64{0, -1, math.NaN(), math.Inf(-1), maxSpeed * 2} {
+		if err := sim.SetSpeed(speed); err == nil {
+			t.Errorf("speed %g should be rejected", speed)
+		}
+	}
+	if sim.interval() != time.Duration(tickDt*float64(time.Second)) {
+		t.Errorf("rejected speeds should leave real time, got %v", sim.interval())
+	}
+}
+
+func TestSetTickResolutionBounds(t *testing.T) {
+	sim := NewSim()
+	if err := sim.SetTickResolution(0); err == nil {
+		t.Error("expected error for zero tick resolution")
+	}
+	if err := sim.SetTickResolution(1.0); err != nil {
+		t.Errorf("1s tick resolution should be valid: %v", err)
+	}
+}
+
+func TestSimFreezeAndStep(t *testing.T) {
+	sim := NewSim()
+	ch := sim.Subscribe()
+	defer sim.Unsubscribe(ch)
+	if err := sim.Play(Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}, RPS: 25000, ReadRatio: 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+	if err := sim.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Frozen: no ticks arrive on their own.
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case tr := <-ch:
+		t.Fatalf("frozen sim published tick %d", tr.Tick)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	before := sim.state.Blocks["s"].Queue
+	tr, err := sim.Step(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ch; got.Tick != tr.Tick {
+		t.Errorf("step should publish its result: want tick %d, got %d", tr.Tick, got.Tick)
+	}
+	if after := sim.state.Blocks["s"].Queue; after <= before {
+		t.Errorf("overloaded queue should grow across steps: %g -> %g", before, after)
+	}
+
+	if err := sim.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-ch:
+		if got.Tick <= tr.Tick {
+			t.Errorf("resume should continue from tick %d, got %d", tr.Tick, got.Tick)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no tick after resume")
+	}
+}
+
+func TestSimStop(t *testing.T) {
+	sim := NewSim()
+	ch := sim.Subscribe()
+	defer sim.Unsubscribe(ch)
+	if err := sim.Play(Topology{Blocks: []TopoBlock{{ID: "s", Kind: "service"}}, RPS: 100}); err != nil {
+		t.Fatal(err)
+	}
+	sim.Freeze()
+	sim.Stop()
+	if tr := <-ch; !tr.Done {
+		t.Error("stop should publish a done result")
+	}
+	if _, err := sim.Step(1); err != ErrNotRunning {
+		t.Errorf("step after stop: want ErrNotRunning, got %v", err)
+	}
+}
+
+func TestTickerSeesScaledProfile(t *testing.T) {
+	metric := func(kind string, replicas, shards int, key string) float64 {
+		g := mustGraph(t, Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "b", Kind: kind, Replicas: replicas, Shards: shards}},
+			Edges:  []TopoEdge{{From: "u", To: "b"}},
+		})
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 20 {
+			results, _ = SimulateTick(g, 500, 0.5, state)
+		}
+		return results[1].Metrics[key]
+	}
+	// Connection pools, thread pools and memory grow with the node, so the
+	// same load leaves them less utilized.
+	for _, c := range []struct{ kind, key string }{
+		{"sql_datastore", "conn_pool_util"},
+		{"worker", "thread_pool_util"},
+		{"redis", "memory_pct"},
+	} {
+		one := metric(c.kind, 1, 1, c.key)
+		four := metric(c.kind, 4, 1, c.key)
+		if one == 0 || math.Abs(four*4/one-1) > 1e-9 {
+			t.Errorf("%s %s: 4 replicas should cut it 4x, got %g then %g", c.kind, c.key, one, four)
+		}
+	}
+	if one, sharded := metric("sql_datastore", 1, 1, "conn_pool_util"), metric("sql_datastore", 1, 2, "conn_pool_util"); math.Abs(sharded*2/one-1) > 1e-9 {
+		t.Errorf("2 shards should double the SQL pool, util %g then %g", one, sharded)
+	}
+}
+
+func TestHotRowLockContention(t *testing.T) {
+	tick := func(writeRPS float64, params map[string]float64) BlockResult {
+		g := mustGraph(t, Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Overrides: params}},
+			Edges:  []TopoEdge{{From: "u", To: "db"}},
+		})
+		state := NewSimState(g)
+		var results []BlockResult
+		for range 20 {
+			results, _ = SimulateTick(g, writeRPS, 0, state)
+		}
+		return results[1]
+	}
+	hot := map[string]float64{ParamHotRowFraction: 0.5, ParamHotRows: 1}
+
+	// One hot row passes 100 writes/s: the wait grows far faster than load.
+	half, most := tick(100, hot), tick(180, hot)
+	if r := most.Metrics["lock_wait_ms"] / half.Metrics["lock_wait_ms"]; r < 5 {
+		t.Errorf("lock wait should grow nonlinearly, %gms then %gms", half.Metrics["lock_wait_ms"], most.Metrics["lock_wait_ms"])
+	}
+
+	// Past the row's rate the hot writes back up behind it, while the cold
+	// half and the same load spread evenly go through.
+	uniform, contended := tick(400, nil), tick(400, hot)
+	if uniform.Health != "green" || !approx(uniform.RPS, 400) {
+		t.Errorf("uniform writes should be easy, got %s at %g RPS", uniform.Health, uniform.RPS)
+	}
+	if !contended.Saturated || !approx(contended.RPS, 300) || contended.QueueDepth == 0 {
+		t.Errorf("hot row should hold back only its own writes, serving 200 cold and 100 hot per second, got %+v", contended)
+	}
+	if spread := tick(400, map[string]float64{ParamHotRowFraction: 0.5, ParamHotRows: 100}); spread.Saturated {
+		t.Errorf("spreading the hot writes over 100 rows should relieve the lock, got %+v", spread)
+	}
+}
+
+func TestDeadlockAbortsCountAsDrops(t *testing.T) {
+	params := map[string]float64{ParamHotRowFraction: 0.5, ParamHotRows: 1}
+	run := func() BlockResult {
+		g := mustGraph(t, Topology{
+			Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "db", Kind: "sql_datastore", Overrides: params}},
+			Edges:  []TopoEdge{{From: "u", To: "db"}},
+		})
+		results, _ := SimulateTick(g, 180, 0, NewSimState(g))
+		return results[1]
+	}
+	if quiet := run(); quiet.Dropped != 0 {
+		t.Errorf("deadlocks are off by default, dropped %g", quiet.Dropped)
+	}
+	params[ParamDeadlocks] = 1
+	db := run()
+	if db.Dropped <= 0 || !approx(db.Dropped, db.Metrics["deadlock_aborts"]) {
+		t.Errorf("deadlock victims should count as drops, got dropped=%g aborts=%g", db.Dropped, db.Metrics["deadlock_aborts"])
+	}
+}
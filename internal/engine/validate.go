@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/blocks"
+	"github.com/prashanth/archimedes/internal/instances"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// maxCompoundFanOut is the product of chained multipliers above which a
+// path is flagged: each hop multiplies the one before it.
+const maxCompoundFanOut = 100
+
+// splitKinds route each request to exactly one downstream, so their outgoing
+// weights are a traffic split and should sum to 1.
+var splitKinds = map[string]bool{"user": true, "load_balancer": true}
+
+// forwardKinds exist to pass traffic on; without an outgoing edge they are
+// almost always a wiring mistake.
+var forwardKinds = map[string]bool{"user": true, "load_balancer": true, "api_gateway": true, "service": true}
+
+// Issue is one validation finding. Edge IDs have the form "from->to".
+type Issue struct {
+	Severity string   `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Blocks   []string `json:"blocks,omitempty"`
+	Edge     string   `json:"edge,omitempty"`
+}
+
+type ValidationReport struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// OK reports whether the topology has no errors. Warnings do not block a run.
+func (r *ValidationReport) OK() bool { return len(r.Errors) == 0 }
+
+func (r *ValidationReport) add(sev, code, msg string, edge string, ids ...string) {
+	is := Issue{Severity: sev, Code: code, Message: msg, Blocks: ids, Edge: edge}
+	if sev == SeverityError {
+		r.Errors = append(r.Errors, is)
+	} else {
+		r.Warnings = append(r.Warnings, is)
+	}
+}
+
+// ValidationError is returned by Play when a topology fails validation.
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	msg := "invalid topology: " + e.Report.Errors[0].Message
+	if n := len(e.Report.Errors); n > 1 {
+		msg += fmt.Sprintf(" (and %d more)", n-1)
+	}
+	return msg
+}
+
+func edgeID(e TopoEdge) string { return e.From + "->" + e.To }
+
+// Validate lints a topology beyond what BuildGraph checks. Errors describe
+// topologies the engine cannot simulate faithfully; warnings describe ones it
+// can run but that probably do not mean what their author intended.
+func Validate(topo Topology) *ValidationReport {
+	r := &ValidationReport{Errors: []Issue{}, Warnings: []Issue{}}
+
+	kinds := make(map[string]string, len(topo.Blocks))
+	byID := make(map[string]TopoBlock, len(topo.Blocks))
+	var order []string // unique block IDs in topology order
+	for _, b := range topo.Blocks {
+		if b.ID == "" {
+			r.add(SeverityError, "empty_id", fmt.Sprintf("%s block has no id", b.Kind), "")
+			continue
+		}
+		if _, dup := kinds[b.ID]; dup {
+			r.add(SeverityError, "duplicate_id", fmt.Sprintf("block id %q is used more than once", b.ID), "", b.ID)
+			continue
+		}
+		kinds[b.ID] = b.Kind
+		byID[b.ID] = b
+		order = append(order, b.ID)
+		if _, ok := blocks.ByKind(b.Kind); !ok {
+			r.add(SeverityError, "unknown_kind", fmt.Sprintf("block %q has unknown kind %q", b.ID, b.Kind), "", b.ID)
+		}
+		if _, ok := instances.Get(b.Instance); b.Instance != "" && !ok {
+			r.add(SeverityError, "unknown_instance", fmt.Sprintf("block %q has unknown instance type %q", b.ID, b.Instance), "", b.ID)
+		}
+		if err := checkDurability(b.Durability); err != nil {
+			r.add(SeverityError, "bad_durability", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+		}
+		if b.Disk != nil {
+			if err := b.Disk.validate(); err != nil {
+				r.add(SeverityError, "bad_disk", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+		if b.CacheModel != nil {
+			if err := b.CacheModel.validate(); err != nil {
+				r.add(SeverityError, "bad_cache_model", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+		if b.Replication != nil {
+			if err := b.Replication.validate(); err != nil {
+				r.add(SeverityError, "bad_replication", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+		if b.ShardSkew != nil {
+			if err := b.ShardSkew.validate(); err != nil {
+				r.add(SeverityError, "bad_shard_skew", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+		if err := checkBalance(b.Balance); err != nil {
+			r.add(SeverityError, "bad_balance", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+		}
+		if err := checkReplicas(b); err != nil {
+			r.add(SeverityError, "bad_replicas", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+		}
+		if err := checkShards(b); err != nil {
+			r.add(SeverityError, "bad_shards", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+		}
+		if b.HealthCheck != nil {
+			if err := b.HealthCheck.validate(); err != nil {
+				r.add(SeverityError, "bad_health_check", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+		for _, k := range slices.Sorted(maps.Keys(b.Overrides)) {
+			if err := checkParam(k, b.Overrides[k]); err != nil {
+				r.add(SeverityError, "bad_override", fmt.Sprintf("block %q: %v", b.ID, err), "", b.ID)
+			}
+		}
+	}
+
+	out := make(map[string][]TopoEdge)
+	for _, e := range topo.Edges {
+		_, fromOK := kinds[e.From]
+		_, toOK := kinds[e.To]
+		if !fromOK || !toOK {
+			missing := e.From
+			if fromOK {
+				missing = e.To
+			}
+			r.add(SeverityError, "unknown_endpoint", fmt.Sprintf("edge %s refers to unknown block %q", edgeID(e), missing), edgeID(e))
+			continue
+		}
+		if e.Weight < 0 || e.Multiplier < 0 {
+			r.add(SeverityError, "negative_weight", fmt.Sprintf("edge %s has a negative weight or multiplier", edgeID(e)), edgeID(e), e.From, e.To)
+		}
+		if err := checkOps(e.Ops); err != nil {
+			r.add(SeverityError, "bad_ops", fmt.Sprintf("edge %s: %v", edgeID(e), err), edgeID(e), e.From, e.To)
+		}
+		if err := checkCachePattern(e); err != nil {
+			r.add(SeverityError, "bad_cache_pattern", fmt.Sprintf("edge %s: %v", edgeID(e), err), edgeID(e), e.From, e.To)
+		}
+		if err := checkBalance(e.Balance); err != nil {
+			r.add(SeverityError, "bad_balance", fmt.Sprintf("edge %s: %v", edgeID(e), err), edgeID(e), e.From, e.To)
+		} else if err := checkBalanceTarget(edgeBalance(e, byID[e.From]), edgeHealthCheck(e, byID[e.From]), byID[e.To]); err != nil {
+			r.add(SeverityError, "bad_balance", fmt.Sprintf("edge %s: %v", edgeID(e), err), edgeID(e), e.From, e.To)
+		}
+		if e.HealthCheck != nil {
+			if err := e.HealthCheck.validate(); err != nil {
+				r.add(SeverityError, "bad_health_check", fmt.Sprintf("edge %s: %v", edgeID(e), err), edgeID(e), e.From, e.To)
+			}
+		}
+		if e.Weight > 1 {
+			r.add(SeverityWarning, "weight_above_one", fmt.Sprintf("edge %s has weight %g; use a multiplier to amplify traffic", edgeID(e), e.Weight), edgeID(e), e.From, e.To)
+		}
+		out[e.From] = append(out[e.From], e)
+	}
+
+	for _, id := range order {
+		kind := kinds[id]
+		edges := out[id]
+		if len(edges) == 0 && forwardKinds[kind] {
+			r.add(SeverityWarning, "dead_end", fmt.Sprintf("%s %q has no outgoing edges; its traffic goes nowhere", kind, id), "", id)
+		}
+		if splitKinds[kind] && len(edges) > 0 {
+			// Reads and writes are split separately; an edge limited to one
+			// counts only toward that one.
+			for _, op := range []string{OpsReads, OpsWrites} {
+				sum, carried := 0.0, false
+				for _, e := range edges {
+					if e.Ops == "" || e.Ops == op {
+						sum += edgeWeight(e)
+						carried = true
+					}
+				}
+				if carried && math.Abs(sum-1) > 1e-6 {
+					r.add(SeverityWarning, "weight_sum", fmt.Sprintf("outgoing %s weights of %s %q sum to %g, not 1", op, kind, id, sum), "", id)
+					break
+				}
+			}
+		}
+	}
+
+	cycles := findCycles(order, out)
+	for _, c := range cycles {
+		r.add(SeverityError, "cycle", "cycle: "+strings.Join(append(c, c[0]), " -> "), "", c...)
+	}
+
+	var users []string
+	for _, id := range order {
+		if kinds[id] == "user" {
+			users = append(users, id)
+		}
+	}
+	if len(users) == 0 && len(order) > 0 {
+		r.add(SeverityWarning, "no_user", "no user block; every block without incoming edges receives the full load", "")
+	} else {
+		seen := reachable(users, out)
+		for _, id := range order {
+			if !seen[id] {
+				r.add(SeverityWarning, "unreachable", fmt.Sprintf("block %q is not reachable from any user and receives no traffic", id), "", id)
+			}
+		}
+	}
+
+	if len(cycles) == 0 {
+		checkFanOut(r, order, out)
+	}
+	return r
+}
+
+// checkFanOut flags edges whose multiplier stacks on an upstream multiplier
+// past maxCompoundFanOut.
+func checkFanOut(r *ValidationReport, order []string, out map[string][]TopoEdge) {
+	// amp is the largest product of multipliers along any path into a block.
+	amp := make(map[string]float64, len(order))
+	for _, id := range order {
+		amp[id] = 1
+	}
+	indeg := make(map[string]int, len(order))
+	for _, id := range order {
+		for _, e := range out[id] {
+			indeg[e.To]++
+		}
+	}
+	var queue []string
+	for _, id := range order {
+		if indeg[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range out[id] {
+			m := edgeMultiplier(e)
+			a := amp[id] * m
+			if m > 1 && amp[id] > 1 && a > maxCompoundFanOut {
+				r.add(SeverityWarning, "fan_out", fmt.Sprintf("multiplier x%g on %s compounds upstream x%g into x%g fan-out", m, edgeID(e), amp[id], a), edgeID(e), e.From, e.To)
+			}
+			amp[e.To] = math.Max(amp[e.To], a)
+			indeg[e.To]--
+			if indeg[e.To] == 0 {
+				queue = append(queue, e.To)
+			}
+		}
+	}
+}
+
+// findCycles returns one cycle per back edge found by a depth-first search,
+// each as the list of block IDs along it.
+func findCycles(order []string, out map[string][]TopoEdge) [][]string {
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	color := make(map[string]int, len(order))
+	var stack []string
+	var cycles [][]string
+	var visit func(id string)
+	visit = func(id string) {
+		color[id] = onStack
+		stack = append(stack, id)
+		for _, e := range out[id] {
+			switch color[e.To] {
+			case unvisited:
+				visit(e.To)
+			case onStack:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == e.To {
+						cycles = append(cycles, append([]string(nil), stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = done
+	}
+	for _, id := range order {
+		if color[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+func reachable(from []string, out map[string][]TopoEdge) map[string]bool {
+	seen := make(map[string]bool)
+	queue := append([]string(nil), from...)
+	for _, id := range from {
+		seen[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range out[id] {
+			if !seen[e.To] {
+				seen[e.To] = true
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	return seen
+}
+
+// edgeWeight and edgeMultiplier apply BuildGraph's defaults.
+func edgeWeight(e TopoEdge) float64 {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+func edgeMultiplier(e TopoEdge) float64 {
+	if e.Multiplier <= 0 {
+		return 1
+	}
+	return e.Multiplier
+}
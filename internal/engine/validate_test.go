@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func issueCodes(issues []Issue) map[string][]Issue {
+	m := make(map[string][]Issue)
+	for _, is := range issues {
+		m[is.Code] = append(m[is.Code], is)
+	}
+	return m
+}
+
+func TestValidateCleanTopology(t *testing.T) {
+	r := Validate(Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "svc", Kind: "service"}, {ID: "db", Kind: "sql_datastore"}},
+		Edges:  []TopoEdge{{From: "u", To: "svc"}, {From: "svc", To: "db"}},
+	})
+	if len(r.Errors) != 0 || len(r.Warnings) != 0 {
+		t.Errorf("expected no issues, got %+v", r)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	r := Validate(Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "a", Kind: "service"},
+			{ID: "b", Kind: "service"},
+			{ID: "b", Kind: "service"},
+			{ID: "x", Kind: "mainframe"},
+		},
+		Edges: []TopoEdge{
+			{From: "u", To: "a"},
+			{From: "a", To: "b"},
+			{From: "b", To: "a"},
+			{From: "b", To: "x"},
+			{From: "a", To: "ghost"},
+		},
+	})
+	if r.OK() {
+		t.Fatal("expected errors")
+	}
+	codes := issueCodes(r.Errors)
+	if is := codes["duplicate_id"]; len(is) != 1 || is[0].Blocks[0] != "b" {
+		t.Errorf("duplicate id: %+v", is)
+	}
+	if is := codes["unknown_kind"]; len(is) != 1 || is[0].Blocks[0] != "x" {
+		t.Errorf("unknown kind: %+v", is)
+	}
+	if is := codes["unknown_endpoint"]; len(is) != 1 || is[0].Edge != "a->ghost" {
+		t.Errorf("unknown endpoint: %+v", is)
+	}
+	if is := codes["cycle"]; len(is) != 1 || len(is[0].Blocks) != 2 {
+		t.Errorf("cycle: %+v", is)
+	}
+}
+
+func TestValidateWarnings(t *testing.T) {
+	r := Validate(Topology{
+		Blocks: []TopoBlock{
+			{ID: "u", Kind: "user"},
+			{ID: "lb", Kind: "load_balancer"},
+			{ID: "svc", Kind: "service"},
+			{ID: "q", Kind: "kafka"},
+			{ID: "w", Kind: "worker"},
+			{ID: "cache", Kind: "redis"},
+			{ID: "orphan", Kind: "sql_datastore"},
+		},
+		Edges: []TopoEdge{
+			{From: "u", To: "lb"},
+			{From: "lb", To: "svc", Weight: 0.6},
+			{From: "svc", To: "q", Multiplier: 20},
+			{From: "q", To: "w"},
+			{From: "w", To: "cache", Multiplier: 50},
+		},
+	})
+	if !r.OK() {
+		t.Fatalf("warnings should not be errors: %+v", r.Errors)
+	}
+	codes := issueCodes(r.Warnings)
+	if is := codes["weight_sum"]; len(is) != 1 || is[0].Blocks[0] != "lb" {
+		t.Errorf("weight sum: %+v", is)
+	}
+	if is := codes["unreachable"]; len(is) != 1 || is[0].Blocks[0] != "orphan" {
+		t.Errorf("unreachable: %+v", is)
+	}
+	if is := codes["fan_out"]; len(is) != 1 || is[0].Edge != "w->cache" {
+		t.Errorf("fan-out: %+v", is)
+	}
+	if is := codes["dead_end"]; len(is) != 0 {
+		t.Errorf("worker and redis are terminal kinds, got dead ends %+v", is)
+	}
+
+	r = Validate(Topology{
+		Blocks: []TopoBlock{{ID: "u", Kind: "user"}, {ID: "svc", Kind: "service"}},
+		Edges:  []TopoEdge{{From: "u", To: "svc"}},
+	})
+	if is := issueCodes(r.Warnings)["dead_end"]; len(is) != 1 || is[0].Blocks[0] != "svc" {
+		t.Errorf("dead end: %+v", is)
+	}
+}
+
+func TestPlayRejectsInvalidTopology(t *testing.T) {
+	sim := NewSim()
+	err := sim.Play(Topology{Blocks: []TopoBlock{{ID: "x", Kind: "mainframe"}}, RPS: 100})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if _, err := sim.Step(1); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("rejected topology should not start a run, got %v", err)
+	}
+}
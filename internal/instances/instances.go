@@ -0,0 +1,53 @@
+// Package instances is the catalog of machine shapes a block can run on, so
+// topologies can say "r6g.2xlarge" instead of raw core and memory counts.
+// The catalog is an embedded JSON file; AWS names are approximate on-demand
+// us-east-1 shapes, and the standard-/highmem- types are generic equivalents.
+package instances
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+//go:embed catalog.json
+var catalog []byte
+
+// Type is one instance shape. DiskIOPS is the local SSD's IOPS when LocalSSD
+// is set, otherwise the baseline of the attached network volume.
+type Type struct {
+	Name        string  `json:"name"`
+	Family      string  `json:"family"`
+	VCPU        int     `json:"vcpu"`
+	MemoryMB    int     `json:"memory_mb"`
+	NetworkGbps float64 `json:"network_gbps"`
+	DiskIOPS    int     `json:"disk_iops"`
+	LocalSSD    bool    `json:"local_ssd,omitempty"`
+	HourlyUSD   float64 `json:"hourly_usd"`
+}
+
+// NetworkMBps is the network bandwidth in megabytes per second.
+func (t Type) NetworkMBps() float64 { return t.NetworkGbps * 1000 / 8 }
+
+var all []Type
+
+func init() {
+	if err := json.Unmarshal(catalog, &all); err != nil {
+		panic(fmt.Sprintf("instance catalog: %v", err))
+	}
+}
+
+// List returns every instance type in catalog order.
+func List() []Type {
+	return append([]Type(nil), all...)
+}
+
+// Get returns the instance type with the given name.
+func Get(name string) (Type, bool) {
+	for _, t := range all {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
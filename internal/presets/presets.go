@@ -0,0 +1,62 @@
+// Package presets holds the built-in example topologies as embedded JSON
+// files. The UI loads them over /api/presets and tests load the same files,
+// so a preset is always the topology that was tested.
+package presets
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+//go:embed *.json
+var files embed.FS
+
+type Preset struct {
+	ID       string          `json:"id"` // file name without .json
+	Name     string          `json:"name"`
+	Order    int             `json:"order"`
+	Topology engine.Topology `json:"topology"`
+}
+
+var all []Preset
+
+func init() {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		data, err := files.ReadFile(e.Name())
+		if err != nil {
+			panic(err)
+		}
+		var p Preset
+		if err := json.Unmarshal(data, &p); err != nil {
+			panic(fmt.Sprintf("preset %s: %v", e.Name(), err))
+		}
+		p.ID = strings.TrimSuffix(e.Name(), path.Ext(e.Name()))
+		all = append(all, p)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Order < all[j].Order })
+}
+
+// List returns every preset in display order.
+func List() []Preset {
+	return append([]Preset(nil), all...)
+}
+
+// Get returns the preset with the given ID.
+func Get(id string) (Preset, bool) {
+	for _, p := range all {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
@@ -0,0 +1,99 @@
+package presets
+
+import (
+	"testing"
+
+	_ "github.com/prashanth/archimedes/internal/blocks/cache"
+	_ "github.com/prashanth/archimedes/internal/blocks/datastore"
+	_ "github.com/prashanth/archimedes/internal/blocks/docstore"
+	_ "github.com/prashanth/archimedes/internal/blocks/kv"
+	_ "github.com/prashanth/archimedes/internal/blocks/queue"
+	_ "github.com/prashanth/archimedes/internal/blocks/search"
+	_ "github.com/prashanth/archimedes/internal/blocks/storage"
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+func mustPreset(t *testing.T, id string) map[string]engine.BlockResult {
+	t.Helper()
+	p, ok := Get(id)
+	if !ok {
+		t.Fatalf("missing preset %q", id)
+	}
+	g, err := engine.BuildGraph(p.Topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.Simulate(g, 2000, 0.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]engine.BlockResult{}
+	for _, r := range results {
+		byID[r.ID] = r
+	}
+	return byID
+}
+
+func TestPresetsLoad(t *testing.T) {
+	list := List()
+	want := []string{"netflix", "ecommerce", "youtube", "newsfeed"}
+	if len(list) != len(want) {
+		t.Fatalf("want %d presets, got %d", len(want), len(list))
+	}
+	for i, p := range list {
+		if p.ID != want[i] {
+			t.Errorf("preset %d: want %s, got %s", i, want[i], p.ID)
+		}
+		g, err := engine.BuildGraph(p.Topology)
+		if err != nil {
+			t.Errorf("%s: %v", p.ID, err)
+			continue
+		}
+		if _, err := g.TopoOrder(); err != nil {
+			t.Errorf("%s: %v", p.ID, err)
+		}
+	}
+}
+
+func TestYouTubePresetTranscodeFanOut(t *testing.T) {
+	byID := mustPreset(t, "youtube")
+	// 15% of viewers hit the API, 5% of that uploads: 2000*0.15*0.05 = 15 RPS.
+	upload := byID["upload-api"].RPS
+	if upload < 14 || upload > 16 {
+		t.Errorf("upload api should see ~15 RPS, got %g", upload)
+	}
+	// Transcoder sees 5x the uploads (resolution variants).
+	if tc := byID["transcoder"].RPS; tc < 4.9*upload {
+		t.Errorf("transcoder should see 5x fan-out of %g, got %g", upload, tc)
+	}
+}
+
+func TestNewsFeedPresetFanOutAmplification(t *testing.T) {
+	byID := mustPreset(t, "newsfeed")
+	// Each post fans out 500x into the feed cache.
+	worker := byID["fan-out-worker"].RPS
+	if worker <= 0 {
+		t.Fatal("fan-out worker should see posts")
+	}
+	if byID["feed-cache"].RPS < 500*worker {
+		t.Errorf("feed cache should see 500x the fan-out worker's %g RPS, got %g", worker, byID["feed-cache"].RPS)
+	}
+}
+
+func TestPresetsValidate(t *testing.T) {
+	for _, p := range List() {
+		if r := engine.Validate(p.Topology); !r.OK() {
+			t.Errorf("%s: %+v", p.ID, r.Errors)
+		}
+	}
+}
+
+func TestNetflixPresetEventShare(t *testing.T) {
+	byID := mustPreset(t, "netflix")
+	// Kafka takes 5% of everything the service handles, reads and writes
+	// alike, as the preset always has.
+	svc, kafka := byID["service"].RPS, byID["kafka"].RPS
+	if svc <= 0 || kafka < 0.049*svc || kafka > 0.051*svc {
+		t.Errorf("kafka should see 5%% of the service's %g RPS, got %g", svc, kafka)
+	}
+}
@@ -0,0 +1,134 @@
+// Package session keys simulations by session or workspace ID so several
+// people can share one server without overwriting each other's topology.
+package session
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+var (
+	ErrTooMany = errors.New("too many active sessions")
+	ErrBadID   = errors.New("session id must be 1-64 letters, digits, '-' or '_'")
+	validID    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	sweepEvery = time.Minute
+)
+
+type entry struct {
+	sim      *engine.Sim
+	lastUsed time.Time
+	holds    int // open event streams; held sessions never expire
+}
+
+type Manager struct {
+	mu       sync.Mutex
+	sessions map[string]*entry
+	max      int
+	idle     time.Duration
+	now      func() time.Time
+	done     chan struct{}
+}
+
+// NewManager allows at most max concurrent sessions and stops any session
+// unused for idle. Call Close to stop the background sweeper.
+func NewManager(max int, idle time.Duration) *Manager {
+	m := &Manager{
+		sessions: make(map[string]*entry),
+		max:      max,
+		idle:     idle,
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+	go m.sweepLoop()
+	return m
+}
+
+// Get returns the session's Sim, creating it if needed.
+func (m *Manager) Get(id string) (*engine.Sim, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return e.sim, nil
+}
+
+// Hold is Get for long-lived event streams: the session cannot expire until
+// the returned release func is called.
+func (m *Manager) Hold(id string) (*engine.Sim, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Look up and hold in one critical section so a sweep can't remove the
+	// session in between.
+	e, err := m.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.holds++
+	release := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		e.holds--
+		e.lastUsed = m.now()
+	}
+	return e.sim, release, nil
+}
+
+// get returns the session's entry, creating it if needed. m.mu must be held.
+func (m *Manager) get(id string) (*entry, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrBadID
+	}
+	e, ok := m.sessions[id]
+	if !ok {
+		if len(m.sessions) >= m.max {
+			return nil, ErrTooMany
+		}
+		e = &entry{sim: engine.NewSim()}
+		m.sessions[id] = e
+	}
+	e.lastUsed = m.now()
+	return e, nil
+}
+
+// Len reports the number of live sessions.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Sweep stops and removes sessions idle longer than the idle timeout.
+func (m *Manager) Sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := m.now().Add(-m.idle)
+	for id, e := range m.sessions {
+		if e.holds == 0 && e.lastUsed.Before(cutoff) {
+			e.sim.Stop()
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func (m *Manager) Close() {
+	close(m.done)
+}
+
+func (m *Manager) sweepLoop() {
+	t := time.NewTicker(sweepEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			m.Sweep()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerSeparateSessions(t *testing.T) {
+	m := NewManager(4, time.Minute)
+	defer m.Close()
+	a, err := m.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := m.Get("bob")
+	again, _ := m.Get("alice")
+	if a == b {
+		t.Error("different sessions should get different sims")
+	}
+	if a != again {
+		t.Error("same session should get the same sim")
+	}
+}
+
+func TestManagerLimit(t *testing.T) {
+	m := NewManager(2, time.Minute)
+	defer m.Close()
+	m.Get("a")
+	m.Get("b")
+	if _, err := m.Get("c"); err != ErrTooMany {
+		t.Errorf("third session: want ErrTooMany, got %v", err)
+	}
+	if _, err := m.Get("a"); err != nil {
+		t.Errorf("existing session should still resolve: %v", err)
+	}
+}
+
+func TestManagerRejectsBadID(t *testing.T) {
+	m := NewManager(2, time.Minute)
+	defer m.Close()
+	if _, err := m.Get("../etc"); err != ErrBadID {
+		t.Errorf("want ErrBadID, got %v", err)
+	}
+}
+
+func TestManagerIdleExpiry(t *testing.T) {
+	m := NewManager(4, time.Minute)
+	defer m.Close()
+	now := time.Unix(0, 0)
+	m.now = func() time.Time { return now }
+
+	m.Get("idle")
+	_, release, _ := m.Hold("streaming")
+
+	now = now.Add(2 * time.Minute)
+	m.Sweep()
+	if m.Len() != 1 {
+		t.Fatalf("idle session should expire, held one should stay: %d live", m.Len())
+	}
+
+	release()
+	now = now.Add(2 * time.Minute)
+	m.Sweep()
+	if m.Len() != 0 {
+		t.Errorf("released session should expire once idle: %d live", m.Len())
+	}
+}
+
+func TestManagerHoldRacesSweep(t *testing.T) {
+	// With no idle allowance every unheld session is swept at once, so the
+	// sweepers remove the session between holds as often as they can.
+	m := NewManager(4, -time.Hour)
+	defer m.Close()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					m.Sweep()
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(done)
+	for range 10000 {
+		sim, release, err := m.Hold("racy")
+		if err != nil || sim == nil {
+			t.Fatalf("Hold: %v", err)
+		}
+		if m.Len() != 1 {
+			t.Fatalf("a held session should survive sweeps: %d live", m.Len())
+		}
+		release()
+	}
+}
@@ -0,0 +1,235 @@
+// Package store keeps named topologies on disk with a version history.
+//
+// Each topology is a directory under the store root holding one JSON file per
+// saved version (1.json, 2.json, ...). Saves never overwrite: they add the
+// next version.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+var (
+	ErrNotFound = errors.New("topology not found")
+	ErrExists   = errors.New("topology already exists")
+	ErrBadName  = errors.New("name must be 1-64 letters, digits, spaces, '.', '-' or '_' and not start with '.'")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9 ._-]{0,63}$`)
+)
+
+// Version is one saved revision of a topology.
+type Version struct {
+	Version  int             `json:"version"`
+	SavedAt  time.Time       `json:"saved_at"`
+	Topology engine.Topology `json:"topology"`
+}
+
+// Entry summarizes a stored topology for listing.
+type Entry struct {
+	Name     string    `json:"name"`
+	Versions int       `json:"versions"`
+	SavedAt  time.Time `json:"saved_at"` // time of the latest version
+}
+
+type Store struct {
+	mu  sync.Mutex
+	dir string
+	now func() time.Time
+}
+
+// Open returns a store rooted at dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, now: time.Now}, nil
+}
+
+func (s *Store) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirents, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, d := range dirents {
+		if !d.IsDir() || !validName.MatchString(d.Name()) {
+			continue
+		}
+		versions, err := s.versions(d.Name())
+		if err != nil || len(versions) == 0 {
+			continue
+		}
+		latest, err := s.read(d.Name(), versions[len(versions)-1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Name: d.Name(), Versions: len(versions), SavedAt: latest.SavedAt})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// Save stores topo as the next version of name.
+func (s *Store) Save(name string, topo engine.Topology) (*Version, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Join(s.dir, name), 0o755); err != nil {
+		return nil, err
+	}
+	versions, err := s.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+	v := &Version{Version: next, SavedAt: s.now().UTC(), Topology: topo}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// Write to a temp file and rename so readers never see a partial version.
+	path := s.versionPath(name, next)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return v, nil
+}
+
+// Load returns the given version of name, or the latest when version is 0.
+func (s *Store) Load(name string, version int) (*Version, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version == 0 {
+		versions, err := s.versions(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, ErrNotFound
+		}
+		version = versions[len(versions)-1]
+	}
+	return s.read(name, version)
+}
+
+// History lists every version of name, oldest first, without topologies.
+func (s *Store) History(name string) ([]Version, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions, err := s.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	out := make([]Version, 0, len(versions))
+	for _, n := range versions {
+		v, err := s.read(name, n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Version{Version: v.Version, SavedAt: v.SavedAt})
+	}
+	return out, nil
+}
+
+// Rename moves name and its whole history to newName.
+func (s *Store) Rename(name, newName string) error {
+	if !validName.MatchString(name) || !validName.MatchString(newName) {
+		return ErrBadName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(s.dir, name)); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, newName)); err == nil {
+		return ErrExists
+	}
+	return os.Rename(filepath.Join(s.dir, name), filepath.Join(s.dir, newName))
+}
+
+// Delete removes name and all its versions.
+func (s *Store) Delete(name string) error {
+	if !validName.MatchString(name) {
+		return ErrBadName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return os.RemoveAll(path)
+}
+
+func (s *Store) versionPath(name string, version int) string {
+	return filepath.Join(s.dir, name, strconv.Itoa(version)+".json")
+}
+
+// versions returns the saved version numbers of name in ascending order.
+func (s *Store) versions(name string) ([]int, error) {
+	dirents, err := os.ReadDir(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []int
+	for _, d := range dirents {
+		n, err := strconv.Atoi(strings.TrimSuffix(d.Name(), ".json"))
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			continue
+		}
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func (s *Store) read(name string, version int) (*Version, error) {
+	data, err := os.ReadFile(s.versionPath(name, version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v Version
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s version %d: %w", name, version, err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/prashanth/archimedes/internal/engine"
+)
+
+func topo(rps float64) engine.Topology {
+	return engine.Topology{
+		Blocks: []engine.TopoBlock{{ID: "u", Kind: "user"}, {ID: "s", Kind: "service", X: 300, Y: 200}},
+		Edges:  []engine.TopoEdge{{From: "u", To: "s"}},
+		RPS:    rps,
+	}
+}
+
+func TestSaveKeepsVersions(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rps := range []float64{100, 200, 300} {
+		if _, err := s.Save("checkout", topo(rps)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := s.Load("checkout", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != 3 || latest.Topology.RPS != 300 {
+		t.Errorf("latest: want v3 at 300 RPS, got v%d at %g", latest.Version, latest.Topology.RPS)
+	}
+	if latest.Topology.Blocks[1].X != 300 {
+		t.Errorf("canvas position should round-trip, got x=%g", latest.Topology.Blocks[1].X)
+	}
+
+	first, err := s.Load("checkout", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Topology.RPS != 100 {
+		t.Errorf("v1: want 100 RPS, got %g", first.Topology.RPS)
+	}
+
+	history, _ := s.History("checkout")
+	if len(history) != 3 {
+		t.Errorf("want 3 versions in history, got %d", len(history))
+	}
+
+	entries, _ := s.List()
+	if len(entries) != 1 || entries[0].Name != "checkout" || entries[0].Versions != 3 {
+		t.Errorf("unexpected list: %+v", entries)
+	}
+}
+
+func TestRenameAndDelete(t *testing.T) {
+	s, _ := Open(t.TempDir())
+	s.Save("a", topo(1))
+	s.Save("b", topo(2))
+
+	if err := s.Rename("a", "b"); err != ErrExists {
+		t.Errorf("rename onto existing: want ErrExists, got %v", err)
+	}
+	if err := s.Rename("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("a", 0); err != ErrNotFound {
+		t.Errorf("old name after rename: want ErrNotFound, got %v", err)
+	}
+	if v, err := s.Load("c", 0); err != nil || v.Topology.RPS != 1 {
+		t.Errorf("renamed topology should keep its history: %v %v", v, err)
+	}
+
+	if err := s.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("c"); err != ErrNotFound {
+		t.Errorf("second delete: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestRejectsBadNames(t *testing.T) {
+	s, _ := Open(t.TempDir())
+	for _, name := range []string{"", "../escape", ".hidden", "a/b"} {
+		if _, err := s.Save(name, topo(1)); err != ErrBadName {
+			t.Errorf("save %q: want ErrBadName, got %v", name, err)
+		}
+	}
+}